@@ -0,0 +1,148 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"unicode/utf8"
+)
+
+var ErrDenied = errors.New("input denied")
+
+// Which lines typed into a pty need approval before they are entered.
+type ApprovalPolicy struct {
+	// Lines matching any of these need approval.
+	Patterns []*regexp.Regexp
+
+	// Called with a matching line before its Enter is sent and holds the writer until it
+	// returns, e.g. while a supervisor decides. A denied line is cleared with Clear
+	// instead of being entered. Without Approve nothing is held.
+	Approve func(line string) bool
+
+	// Shell the lines are typed into, it decides how a line is cleared.
+	Shell ShellSyntax
+
+	// Sent to clear a denied line, nil is Ctrl-U for POSIX shells and Esc for
+	// PowerShell and cmd.exe.
+	Clear []byte
+}
+
+func (p *ApprovalPolicy) clear() []byte {
+	switch {
+	case p.Clear != nil:
+		return p.Clear
+	case p.Shell == ShellPOSIX:
+		return []byte{0x15}
+	default:
+		return []byte{0x1b}
+	}
+}
+
+type approvalWriter struct {
+	w       io.Writer
+	policy  ApprovalPolicy
+	line    []byte
+	scanner vtScanner
+	// keys the line can't be followed through were typed, like cursor keys,
+	// Tab completion or history recall
+	unknown bool
+	// unknown before the current escape sequence started
+	wasUnknown bool
+	paste      bool
+}
+
+// Hold lines written to w, the writer of a pty, that match policy until they are approved.
+// The line is reconstructed from what is typed. Once keys that can change it in ways
+// not seen here were typed, like cursor keys, Tab or Ctrl-R, the line goes to Approve
+// whether it matches or not, as far as it is known.
+// A write with a denied line fails with ErrDenied after the line was cleared, the
+// rest of it is not written.
+func NewApprovalWriter(w io.Writer, policy ApprovalPolicy) io.Writer {
+	return &approvalWriter{w: w, policy: policy}
+}
+
+func (w *approvalWriter) Write(b []byte) (int, error) {
+	written := 0
+	for i, c := range b {
+		ground := w.scanner.state == vtGround
+		w.scanner.scan(b[i:i+1], w.sequence)
+		if !ground {
+			continue
+		}
+
+		switch {
+		case c == 0x1b:
+			// bracketed paste markers are the only sequences that leave the line as is
+			w.wasUnknown = w.unknown
+			w.unknown = true
+		case c == '\r' || c == '\n':
+			line := string(w.line)
+			held := w.matches(line)
+			w.reset()
+			if !held {
+				continue
+			}
+			// send the line itself, then hold its Enter
+			if _, err := w.w.Write(b[written:i]); err != nil {
+				return written, err
+			}
+			written = i
+			if !w.policy.Approve(line) {
+				if _, err := w.w.Write(w.policy.clear()); err != nil {
+					return written, err
+				}
+				return i + 1, ErrDenied
+			}
+		case c == 0x7f || c == 0x08:
+			_, size := utf8.DecodeLastRune(w.line)
+			w.line = w.line[:len(w.line)-size]
+		case c == 0x03 || c == 0x15 && w.policy.Shell == ShellPOSIX:
+			// Ctrl-C drops the line, Ctrl-U too in readline
+			w.reset()
+		case c >= 0x20 || c == '\t' && w.paste:
+			w.line = append(w.line, c)
+		default:
+			w.unknown = true
+		}
+	}
+	n, err := w.w.Write(b[written:])
+	return written + n, err
+}
+
+func (w *approvalWriter) sequence(seq vtSequence) {
+	if seq.kind != vtCSI || seq.final != '~' {
+		return
+	}
+	switch string(seq.params) {
+	case "200":
+		w.paste = true
+	case "201":
+		w.paste = false
+	default:
+		return
+	}
+	w.unknown = w.wasUnknown
+}
+
+func (w *approvalWriter) reset() {
+	w.line = w.line[:0]
+	w.unknown = false
+}
+
+func (w *approvalWriter) matches(line string) bool {
+	if w.policy.Approve == nil {
+		return false
+	}
+	if w.unknown {
+		return true
+	}
+	for _, pattern := range w.policy.Patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestApprovalWriter(t *testing.T) {
+	rm := []*regexp.Regexp{regexp.MustCompile(`^rm `)}
+	for _, tc := range []struct {
+		name     string
+		writes   []string
+		patterns []*regexp.Regexp
+		deny     bool
+		noHook   bool
+		shell    ShellSyntax
+		clear    []byte
+		// lines Approve was asked about
+		asked []string
+		out   string
+		err   error
+	}{
+		{name: "no match", writes: []string{"ls\r"}, patterns: rm, out: "ls\r"},
+		{name: "approved", writes: []string{"rm a\r"}, patterns: rm, asked: []string{"rm a"}, out: "rm a\r"},
+		{name: "denied", writes: []string{"rm a\rls\r"}, patterns: rm, deny: true, asked: []string{"rm a"}, out: "rm a\x15", err: ErrDenied},
+		{name: "LF", writes: []string{"rm a\n"}, patterns: rm, asked: []string{"rm a"}, out: "rm a\n"},
+		{name: "split writes", writes: []string{"rm", " a", "\r"}, patterns: rm, asked: []string{"rm a"}, out: "rm a\r"},
+		{name: "backspace", writes: []string{"rx\x7fm ä\x08a\r"}, patterns: rm, asked: []string{"rm a"}, out: "rx\x7fm ä\x08a\r"},
+		{name: "ctrl-u", writes: []string{"rm a\x15ls\r"}, patterns: rm, out: "rm a\x15ls\r"},
+		{name: "ctrl-c", writes: []string{"rm a\x03ls\r"}, patterns: rm, out: "rm a\x03ls\r"},
+		{name: "escape sequences", writes: []string{"\x1b[A\x1b[200~rm a\x1b[201~\r"}, patterns: rm, asked: []string{"rm a"}, out: "\x1b[A\x1b[200~rm a\x1b[201~\r"},
+		{name: "sequence split", writes: []string{"\x1b[2", "00~rm a\r"}, patterns: rm, asked: []string{"rm a"}, out: "\x1b[200~rm a\r"},
+		{name: "without approve", writes: []string{"rm a\r"}, patterns: rm, noHook: true, out: "rm a\r"},
+		{name: "cmd denied", writes: []string{"rm a\r"}, patterns: rm, deny: true, shell: ShellCmd, asked: []string{"rm a"}, out: "rm a\x1b", err: ErrDenied},
+		{name: "powershell denied", writes: []string{"rm a\r"}, patterns: rm, deny: true, shell: ShellPowerShell, asked: []string{"rm a"}, out: "rm a\x1b", err: ErrDenied},
+		{name: "custom clear", writes: []string{"rm a\r"}, patterns: rm, deny: true, clear: []byte{0x01, 0x0b}, asked: []string{"rm a"}, out: "rm a\x01\x0b", err: ErrDenied},
+		// lines changed in ways the writer can't follow always go to Approve
+		{name: "history", writes: []string{"\x1b[A\r"}, patterns: rm, asked: []string{""}, out: "\x1b[A\r"},
+		{name: "reverse search", writes: []string{"\x12rm\r"}, patterns: rm, asked: []string{"rm"}, out: "\x12rm\r"},
+		{name: "tab", writes: []string{"l\t\r"}, patterns: rm, asked: []string{"l"}, out: "l\t\r"},
+		{name: "known after enter", writes: []string{"\x1b[A\rls\r"}, patterns: rm, asked: []string{""}, out: "\x1b[A\rls\r"},
+		{name: "cmd ctrl-u", writes: []string{"rm a\x15ls\r"}, patterns: rm, shell: ShellCmd, asked: []string{"rm als"}, out: "rm a\x15ls\r"},
+		{name: "tab in paste", writes: []string{"\x1b[200~a\tb\x1b[201~\r"}, patterns: rm, out: "\x1b[200~a\tb\x1b[201~\r"},
+	} {
+		var out bytes.Buffer
+		var asked []string
+		policy := ApprovalPolicy{Patterns: tc.patterns, Shell: tc.shell, Clear: tc.clear}
+		if !tc.noHook {
+			policy.Approve = func(line string) bool {
+				// the line is typed, its Enter is held
+				if bytes.ContainsAny(out.Bytes(), "\r\n") {
+					t.Errorf("%s: Enter of %q sent before approval, got %q", tc.name, line, out.String())
+				}
+				asked = append(asked, line)
+				return !tc.deny
+			}
+		}
+		w := NewApprovalWriter(&out, policy)
+		var err error
+		for _, write := range tc.writes {
+			var n int
+			n, err = w.Write([]byte(write))
+			if err != nil {
+				if n > len(write) {
+					t.Errorf("%s: wrote %d of %d bytes", tc.name, n, len(write))
+				}
+				break
+			}
+			if n != len(write) {
+				t.Errorf("%s: wrote %d of %d bytes", tc.name, n, len(write))
+			}
+		}
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+		}
+		if out.String() != tc.out {
+			t.Errorf("%s: got %q, want %q", tc.name, out.String(), tc.out)
+		}
+		if strings.Join(asked, "\n") != strings.Join(tc.asked, "\n") {
+			t.Errorf("%s: asked about %q, want %q", tc.name, asked, tc.asked)
+		}
+	}
+}
+
+func TestApprovalWriterDeniedCount(t *testing.T) {
+	var out bytes.Buffer
+	w := NewApprovalWriter(&out, ApprovalPolicy{
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`^rm `)},
+		Approve:  func(string) bool { return false },
+	})
+	// the denied Enter counts as written, the rest doesn't
+	if n, err := w.Write([]byte("rm a\rls\r")); n != 5 || !errors.Is(err, ErrDenied) {
+		t.Errorf("got %d, %v, want 5, %v", n, err, ErrDenied)
+	}
+}
+
+func FuzzApprovalWriter(f *testing.F) {
+	for _, seed := range []string{
+		"rm a\r", "\x1b[A\r", "rx\x7fm ä\x08a\r", "\x1b[200~rm a\x1b[201~\r", "rm a\x15ls\r", "\x12rm\t\n",
+	} {
+		f.Add([]byte(seed), false)
+	}
+	f.Fuzz(func(t *testing.T, in []byte, deny bool) {
+		run := func(split bool) (string, []string, error) {
+			var out bytes.Buffer
+			var asked []string
+			w := NewApprovalWriter(&out, ApprovalPolicy{
+				Patterns: []*regexp.Regexp{regexp.MustCompile(`^rm `)},
+				Approve: func(line string) bool {
+					asked = append(asked, line)
+					return !deny
+				},
+			})
+			written := 0
+			var err error
+			for rest := in; len(rest) > 0 && err == nil; {
+				chunk := rest
+				if split {
+					chunk = rest[:1]
+				}
+				var n int
+				n, err = w.Write(chunk)
+				written += n
+				rest = rest[len(chunk):]
+			}
+			if err == nil && written != len(in) {
+				t.Fatalf("wrote %d of %d bytes", written, len(in))
+			}
+			if err != nil && !errors.Is(err, ErrDenied) {
+				t.Fatalf("got %v", err)
+			}
+			return out.String(), asked, err
+		}
+
+		out, asked, err := run(false)
+		if err == nil && out != string(in) {
+			t.Fatalf("approved input changed: got %q, want %q", out, in)
+		}
+		splitOut, splitAsked, splitErr := run(true)
+		if splitOut != out || strings.Join(splitAsked, "\n") != strings.Join(asked, "\n") || splitErr != err {
+			t.Fatalf("one byte at a time: %q %q %v, whole: %q %q %v", splitOut, splitAsked, splitErr, out, asked, err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Error of a goroutine the package runs in the background, like the drain after
+// Pty.Close or the host resize forwarding of BindHostResize.
+type BackgroundError struct {
+	// The pty the goroutine worked for, so hosts running many can tell which one failed.
+	Backend Backend
+	Op      string
+	Err     error
+}
+
+func (e *BackgroundError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *BackgroundError) Unwrap() error {
+	return e.Err
+}
+
+var backgroundHandler atomic.Pointer[func(*BackgroundError)]
+
+// Report errors of background goroutines to handler so hosts can react to them,
+// otherwise they are only logged. handler is called from those goroutines and
+// shouldn't block. nil removes the handler.
+func OnBackgroundError(handler func(*BackgroundError)) {
+	if handler == nil {
+		backgroundHandler.Store(nil)
+		return
+	}
+	backgroundHandler.Store(&handler)
+}
+
+func reportBackground(p Backend, op string, err error) {
+	if handler := backgroundHandler.Load(); handler != nil {
+		(*handler)(&BackgroundError{Backend: p, Op: op, Err: err})
+	}
+}
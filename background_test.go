@@ -0,0 +1,35 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOnBackgroundError(t *testing.T) {
+	defer OnBackgroundError(nil)
+	var p Backend = &closingBackend{}
+	cause := errors.New("broken")
+
+	var got []*BackgroundError
+	OnBackgroundError(func(err *BackgroundError) { got = append(got, err) })
+	reportBackground(p, "resize", cause)
+	if len(got) != 1 {
+		t.Fatalf("got %d reports, want 1", len(got))
+	}
+	if got[0].Backend != p || got[0].Op != "resize" || !errors.Is(got[0], cause) {
+		t.Errorf("got %+v", got[0])
+	}
+	if want := "resize: broken"; got[0].Error() != want {
+		t.Errorf("got %q, want %q", got[0].Error(), want)
+	}
+
+	// without a handler nothing is reported
+	OnBackgroundError(nil)
+	reportBackground(p, "close", cause)
+	if len(got) != 1 {
+		t.Errorf("got %d reports after removing the handler", len(got))
+	}
+}
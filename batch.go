@@ -0,0 +1,55 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import "strings"
+
+// %cd:~,% is an empty substring of %cd%, written for every % it stops %VAR% from
+// being expanded
+const batchPercent = "%%cd:~,%"
+
+// Write path, already checked to need no quoting of its own, with its % escaped.
+func appendBatchPath(line *strings.Builder, path string) {
+	line.WriteString(strings.ReplaceAll(path, "%", batchPercent))
+}
+
+// Same rules as Rust's std uses for batch files after CVE-2024-24576.
+func appendBatchArg(line *strings.Builder, arg string) {
+	// empty arguments would disappear and a trailing backslash would break "%~1"
+	quote := arg == "" || strings.HasSuffix(arg, `\`)
+	for _, c := range arg {
+		// ASCII symbols are quoted unless known to be harmless
+		if c < 0x80 && !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.ContainsRune(`#$*+-./:?@\_`, c)) {
+			quote = true
+		}
+	}
+
+	if quote {
+		line.WriteByte('"')
+	}
+	backslashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			backslashes++
+			line.WriteRune(c)
+			continue
+		case '"':
+			// double the backslashes in front of it, then escape it by doubling
+			line.WriteString(strings.Repeat(`\`, backslashes))
+			line.WriteByte('"')
+		case '%':
+			line.WriteString(batchPercent)
+			backslashes = 0
+			continue
+		}
+		backslashes = 0
+		line.WriteRune(c)
+	}
+	if quote {
+		line.WriteString(strings.Repeat(`\`, backslashes))
+		line.WriteByte('"')
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAppendBatchArg(t *testing.T) {
+	for _, tc := range []struct {
+		arg  string
+		want string
+	}{
+		{"plain", "plain"},
+		{`C:\dir\file.txt`, `C:\dir\file.txt`},
+		{"", `""`},
+		{"a b", `"a b"`},
+		{"%", `"%%cd:~,%"`},
+		{"%PATH%", `"%%cd:~,%PATH%%cd:~,%"`},
+		{`a\%`, `"a\%%cd:~,%"`},
+		{"^", `"^"`},
+		{"a&b", `"a&b"`},
+		{"a|b", `"a|b"`},
+		{`a"b`, `"a""b"`},
+		{`a\"b`, `"a\\""b"`},
+		{`a\`, `"a\\"`},
+		{`a\\`, `"a\\\\"`},
+		{"ü", "ü"},
+	} {
+		var line strings.Builder
+		appendBatchArg(&line, tc.arg)
+		if got := line.String(); got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.arg, got, tc.want)
+		}
+	}
+}
+
+func TestAppendBatchPath(t *testing.T) {
+	var line strings.Builder
+	appendBatchPath(&line, `C:\100%\%TEMP%.bat`)
+	if want := `C:\100%%cd:~,%\%%cd:~,%TEMP%%cd:~,%.bat`; line.String() != want {
+		t.Errorf("got %s, want %s", line.String(), want)
+	}
+}
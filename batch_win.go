@@ -0,0 +1,54 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Wrapped around paths and arguments BatchCommand can't pass on, check with errors.Is.
+var ErrBatchArg = errors.New("can't be passed to cmd.exe")
+
+// Build the command for running the .bat or .cmd file at path with args through
+// cmd.exe /d /c. Arguments are quoted so cmd.exe passes them on literally, without
+// expanding %variables% or interpreting carets, & and |.
+// Line breaks can't be passed through cmd.exe at all and fail with ErrBatchArg.
+func BatchCommand(path string, args ...string) (*exec.Cmd, error) {
+	// file names can't contain quotes, a trailing backslash would escape the closing one
+	if strings.ContainsAny(path, "\"\x00\r\n") || strings.HasSuffix(path, `\`) {
+		return nil, fmt.Errorf("%w: %q", ErrBatchArg, path)
+	}
+
+	comspec := os.Getenv("ComSpec")
+	if comspec == "" {
+		comspec = filepath.Join(os.Getenv("SystemRoot"), "System32", "cmd.exe")
+	}
+
+	// /e:ON is needed for the %cd:~,% escape, cmd.exe strips the quotes around everything
+	var line strings.Builder
+	line.WriteString(`cmd.exe /e:ON /v:OFF /d /c ""`)
+	appendBatchPath(&line, path)
+	line.WriteByte('"')
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "\x00\r\n") {
+			return nil, fmt.Errorf("%w: %q", ErrBatchArg, arg)
+		}
+		line.WriteByte(' ')
+		appendBatchArg(&line, arg)
+	}
+	line.WriteByte('"')
+
+	cmd := &exec.Cmd{
+		Path:        comspec,
+		Args:        append([]string{comspec, "/e:ON", "/v:OFF", "/d", "/c", path}, args...),
+		SysProcAttr: &syscall.SysProcAttr{CmdLine: line.String()},
+	}
+	return cmd, nil
+}
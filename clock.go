@@ -0,0 +1,36 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import "time"
+
+// Source of time for the delays and timeouts that take one, like SendOptions.Clock,
+// so tests can substitute a fake clock like ptytest.FakeClock and run instantly and
+// deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+// The clock of the time package, used wherever no Clock is given.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
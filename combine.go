@@ -0,0 +1,90 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Longer lines are split, every part tagged on its own.
+const combinerMaxLine = 64 * 1024
+
+// Combiner merges the output of many sessions into one stream for central logging.
+// Lines are never interleaved with each other and every line starts with the tag of
+// the session it came from.
+type Combiner struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+	// first reader that failed, the others keep being combined
+	readErr error
+	wg      sync.WaitGroup
+}
+
+func NewCombiner(w io.Writer) *Combiner {
+	return &Combiner{w: w}
+}
+
+// Copy r to the combined stream in its own goroutine until it fails, every line
+// prefixed with "[name] ". A last line without a newline is completed when r ends.
+func (c *Combiner) Add(name string, r io.Reader) {
+	tag := []byte("[" + name + "] ")
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		reader := bufio.NewReaderSize(r, combinerMaxLine)
+		for {
+			line, err := reader.ReadSlice('\n')
+			if len(line) > 0 {
+				c.writeLine(tag, line)
+			}
+			if err != nil && err != bufio.ErrBufferFull {
+				if err != io.EOF {
+					c.failRead(fmt.Errorf("%s: %w", name, err))
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (c *Combiner) failRead(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readErr == nil {
+		c.readErr = err
+	}
+}
+
+func (c *Combiner) writeLine(tag []byte, line []byte) {
+	out := make([]byte, 0, len(tag)+len(line)+1)
+	out = append(out, tag...)
+	out = append(out, line...)
+	if line[len(line)-1] != '\n' {
+		out = append(out, '\n')
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// keep draining the sessions even when the log is gone so they don't block
+	if c.err != nil {
+		return
+	}
+	_, c.err = c.w.Write(out)
+}
+
+// Wait until all added readers ended and return the first error writing the
+// combined stream, or else the first error reading one of them other than io.EOF.
+func (c *Combiner) Wait() error {
+	c.wg.Wait()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.readErr
+}
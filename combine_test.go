@@ -0,0 +1,97 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// A failing session is reported by Wait, the others are still combined.
+func TestCombinerReadError(t *testing.T) {
+	var out bytes.Buffer
+	c := NewCombiner(&out)
+	cause := errors.New("broken")
+	c.Add("bad", io.MultiReader(strings.NewReader("partial\n"), iotest.ErrReader(cause)))
+	c.Wait()
+	c.Add("good", strings.NewReader("line\n"))
+
+	if err := c.Wait(); !errors.Is(err, cause) || !strings.HasPrefix(err.Error(), "bad: ") {
+		t.Errorf("got %v, want bad: %v", err, cause)
+	}
+	if want := "[bad] partial\n[good] line\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+// Lines of sessions writing at the same time never interleave.
+func TestCombinerLines(t *testing.T) {
+	var out bytes.Buffer
+	c := NewCombiner(&out)
+	names := []string{"a", "b", "c", "d"}
+	for _, name := range names {
+		var in strings.Builder
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(&in, "%s line %d\n", name, i)
+		}
+		// byte by byte, so the sessions' reads interleave
+		c.Add(name, iotest.OneByteReader(strings.NewReader(in.String())))
+	}
+	if err := c.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	next := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var name, again string
+		var i int
+		if _, err := fmt.Sscanf(line, "[%1s] %s line %d", &name, &again, &i); err != nil || name != again || i != next[name] {
+			t.Fatalf("mangled line %q", line)
+		}
+		next[name]++
+	}
+	for _, name := range names {
+		if next[name] != 100 {
+			t.Errorf("%s: got %d lines, want 100", name, next[name])
+		}
+	}
+}
+
+func TestCombinerSplitsLongLines(t *testing.T) {
+	var out bytes.Buffer
+	c := NewCombiner(&out)
+	long := strings.Repeat("x", combinerMaxLine+10)
+	c.Add("s", strings.NewReader(long+"\n"))
+	c.Wait()
+
+	want := "[s] " + long[:combinerMaxLine] + "\n[s] " + long[combinerMaxLine:] + "\n"
+	if out.String() != want {
+		t.Errorf("got %d bytes, want %d split after %d", out.Len(), len(want), combinerMaxLine)
+	}
+}
+
+func TestCombinerCompletesLastLine(t *testing.T) {
+	var out bytes.Buffer
+	c := NewCombiner(&out)
+	c.Add("s", strings.NewReader("done\nno newline"))
+	c.Wait()
+	if want := "[s] done\n[s] no newline\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+// A failing log stops writing but the sessions are still drained.
+func TestCombinerWriteError(t *testing.T) {
+	cause := errors.New("disk full")
+	c := NewCombiner(writerFunc(func([]byte) (int, error) { return 0, cause }))
+	c.Add("s", strings.NewReader("a\nb\nc\n"))
+	if err := c.Wait(); !errors.Is(err, cause) {
+		t.Errorf("got %v, want %v", err, cause)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+var ErrNotElevated = errors.New("not elevated")
+
+// Get a token for spawning elevated children.
+// Set it as cmd.SysProcAttr.Token before SpawnCommand and close it afterwards.
+//
+// This only works if the current process is elevated itself, the linked token
+// of a filtered admin token can't be used to create processes.
+// Non-elevated hosts can only start an elevated process through ShellExecute
+// with the "runas" verb, which shows the UAC prompt but can't attach the
+// process to a pty.
+func ElevatedToken() (windows.Token, error) {
+	var token windows.Token
+	if err := windows.OpenProcessToken(
+		windows.CurrentProcess(),
+		windows.TOKEN_DUPLICATE|windows.TOKEN_QUERY,
+		&token,
+	); err != nil {
+		logger.Println(err)
+		return 0, err
+	}
+	defer token.Close()
+
+	if !token.IsElevated() {
+		return 0, ErrNotElevated
+	}
+
+	var dup windows.Token
+	if err := windows.DuplicateTokenEx(
+		token,
+		windows.MAXIMUM_ALLOWED,
+		nil,
+		windows.SecurityImpersonation,
+		windows.TokenPrimary,
+		&dup,
+	); err != nil {
+		logger.Println(err)
+		return 0, err
+	}
+	return dup, nil
+}
@@ -0,0 +1,84 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Locale set by EnsureUTF8Locale, available on glibc, musl and recent macOS.
+const fallbackLocale = "C.UTF-8"
+
+// Environment of cmd, defaulting to the one of the current process like exec.Cmd does.
+func cmdEnv(env []string) []string {
+	if env == nil {
+		return os.Environ()
+	}
+	return env
+}
+
+// Value of key in env and whether it is set.
+func lookupEnv(env []string, key string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Set key in env, replacing all previous values.
+func setEnv(env []string, key, value string) []string {
+	out := env[:0:0]
+	for _, kv := range env {
+		if k, _, ok := strings.Cut(kv, "="); ok && k == key {
+			continue
+		}
+		out = append(out, kv)
+	}
+	return append(out, key+"="+value)
+}
+
+// Make sure the locale of cmd resolves to UTF-8, so tools don't fall back to ASCII
+// output in the C locale. An environment that already has a UTF-8 locale, through
+// LC_ALL, LC_CTYPE or LANG in that order, is left alone. Otherwise the character
+// type is set to C.UTF-8 and messages etc. keep their language.
+func EnsureUTF8Locale(cmd *exec.Cmd) {
+	env := cmdEnv(cmd.Env)
+	effective := ""
+	for _, key := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value, _ := lookupEnv(env, key); value != "" {
+			effective = value
+			break
+		}
+	}
+	if isUTF8Locale(effective) {
+		return
+	}
+
+	if all, _ := lookupEnv(env, "LC_ALL"); all != "" {
+		// LC_ALL overrides everything, it has to change
+		env = setEnv(env, "LC_ALL", fallbackLocale)
+	} else {
+		env = setEnv(env, "LC_CTYPE", fallbackLocale)
+		if lang, _ := lookupEnv(env, "LANG"); lang == "" {
+			env = setEnv(env, "LANG", fallbackLocale)
+		}
+	}
+	cmd.Env = env
+}
+
+func isUTF8Locale(locale string) bool {
+	// the codeset is between the territory and the modifier, e.g. en_US.UTF-8@euro,
+	// macOS also sets LC_CTYPE to a bare UTF-8
+	_, codeset, found := strings.Cut(locale, ".")
+	if !found {
+		codeset = locale
+	}
+	codeset, _, _ = strings.Cut(codeset, "@")
+	codeset = strings.ToLower(strings.ReplaceAll(codeset, "-", ""))
+	return codeset == "utf8"
+}
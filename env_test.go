@@ -0,0 +1,54 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestIsUTF8Locale(t *testing.T) {
+	for _, tc := range []struct {
+		locale string
+		want   bool
+	}{
+		{"en_US.UTF-8", true},
+		{"de_DE.utf8", true},
+		{"en_IE.UTF-8@euro", true},
+		{"C.UTF-8", true},
+		{"UTF-8", true},
+		{"utf8", true},
+		{"", false},
+		{"C", false},
+		{"POSIX", false},
+		{"en_US", false},
+		{"en_US.ISO-8859-1", false},
+		{"de_DE@euro", false},
+	} {
+		if got := isUTF8Locale(tc.locale); got != tc.want {
+			t.Errorf("%q: got %t, want %t", tc.locale, got, tc.want)
+		}
+	}
+}
+
+func TestEnsureUTF8Locale(t *testing.T) {
+	for _, tc := range []struct {
+		env  []string
+		want []string
+	}{
+		{[]string{"LANG=en_US.UTF-8"}, []string{"LANG=en_US.UTF-8"}},
+		{[]string{"LC_CTYPE=UTF-8"}, []string{"LC_CTYPE=UTF-8"}},
+		{[]string{}, []string{"LC_CTYPE=C.UTF-8", "LANG=C.UTF-8"}},
+		// messages keep their language
+		{[]string{"LANG=de_DE"}, []string{"LANG=de_DE", "LC_CTYPE=C.UTF-8"}},
+		{[]string{"LC_ALL=C", "LANG=en_US.UTF-8"}, []string{"LANG=en_US.UTF-8", "LC_ALL=C.UTF-8"}},
+	} {
+		cmd := &exec.Cmd{Env: tc.env}
+		EnsureUTF8Locale(cmd)
+		if got := strings.Join(cmd.Env, " "); got != strings.Join(tc.want, " ") {
+			t.Errorf("%q: got %q, want %q", tc.env, cmd.Env, tc.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"io"
+)
+
+type ImageProtocol int
+
+const (
+	ImageSixel ImageProtocol = iota
+	ImageITerm2
+	ImageKitty
+)
+
+// An inline image found in the output.
+type Image struct {
+	Protocol ImageProtocol
+	// The complete escape sequence, including introducer and terminator.
+	Sequence []byte
+}
+
+// Images bigger than this are still stripped but not reported.
+const maxImageSize = 32 << 20
+
+const iterm2Prefix = "\x1b]1337;File="
+
+type imageState int
+
+const (
+	imageGround imageState = iota
+	imageEscape
+	imageDCS
+	imageOSC
+	imageAPC
+	imageBody
+	imageBodyEscape
+)
+
+// ImageFilter finds sixel, iTerm2 and kitty inline images in the output of a pty,
+// so frontends can render them or strip them instead of displaying garbage.
+type ImageFilter struct {
+	r        io.Reader
+	onImage  func(Image)
+	strip    bool
+	state    imageState
+	protocol ImageProtocol
+	// bytes of a sequence that might still turn out to be an image
+	hold []byte
+	// the current image, nil once it got too big
+	image []byte
+	out   []byte
+	buf   []byte
+	err   error
+}
+
+// Wrap r so onImage is called for every complete image, onImage can be nil.
+// If strip is set the images are removed from the output.
+func NewImageFilter(r io.Reader, onImage func(Image), strip bool) *ImageFilter {
+	return &ImageFilter{
+		r:       r,
+		onImage: onImage,
+		strip:   strip,
+		buf:     make([]byte, 4096),
+	}
+}
+
+func (f *ImageFilter) Read(b []byte) (int, error) {
+	// stripping can leave nothing from a read, only return once there is output or an error
+	for len(f.out) == 0 && f.err == nil {
+		n, err := f.r.Read(f.buf)
+		for _, c := range f.buf[:n] {
+			f.feed(c)
+		}
+		f.err = err
+	}
+	if len(f.out) == 0 {
+		// pass on whatever was held back, the stream ended
+		f.out = append(f.out, f.hold...)
+		f.hold = f.hold[:0]
+		// an ESC in an image is only held as state
+		if f.state == imageBodyEscape && !f.strip {
+			f.out = append(f.out, 0x1b)
+		}
+		f.state = imageGround
+		if len(f.out) == 0 {
+			return 0, f.err
+		}
+	}
+	n := copy(b, f.out)
+	f.out = f.out[:copy(f.out, f.out[n:])]
+	return n, nil
+}
+
+func (f *ImageFilter) feed(c byte) {
+	switch f.state {
+	case imageGround:
+		if c == 0x1b {
+			f.hold = append(f.hold, c)
+			f.state = imageEscape
+		} else {
+			f.out = append(f.out, c)
+		}
+	case imageEscape:
+		f.hold = append(f.hold, c)
+		switch c {
+		case 'P':
+			f.state = imageDCS
+		case ']':
+			f.state = imageOSC
+		case '_':
+			f.state = imageAPC
+		default:
+			f.notImage()
+		}
+	case imageDCS:
+		f.hold = append(f.hold, c)
+		switch {
+		case c >= '0' && c <= '9' || c == ';':
+		case c == 'q':
+			f.begin(ImageSixel)
+		default:
+			f.notImage()
+		}
+	case imageOSC:
+		f.hold = append(f.hold, c)
+		if !bytes.HasPrefix([]byte(iterm2Prefix), f.hold) {
+			f.notImage()
+		} else if len(f.hold) == len(iterm2Prefix) {
+			f.begin(ImageITerm2)
+		}
+	case imageAPC:
+		f.hold = append(f.hold, c)
+		if c == 'G' {
+			f.begin(ImageKitty)
+		} else {
+			f.notImage()
+		}
+	case imageBody:
+		switch {
+		case c == 0x1b:
+			f.state = imageBodyEscape
+		case c == 0x07 && f.protocol == ImageITerm2:
+			f.body(c)
+			f.end()
+		default:
+			f.body(c)
+		}
+	case imageBodyEscape:
+		if c == '\\' {
+			f.body(0x1b)
+			f.body(c)
+			f.end()
+		} else {
+			// cancelled by another sequence
+			f.image = nil
+			f.hold = append(f.hold, 0x1b)
+			f.state = imageEscape
+			f.feed(c)
+		}
+	}
+}
+
+// The held bytes are not an image, pass them on.
+// The last byte might start a new sequence.
+func (f *ImageFilter) notImage() {
+	last := f.hold[len(f.hold)-1]
+	f.out = append(f.out, f.hold[:len(f.hold)-1]...)
+	f.hold = f.hold[:0]
+	f.state = imageGround
+	f.feed(last)
+}
+
+func (f *ImageFilter) begin(protocol ImageProtocol) {
+	f.protocol = protocol
+	f.state = imageBody
+	f.image = append([]byte(nil), f.hold...)
+	if !f.strip {
+		f.out = append(f.out, f.hold...)
+	}
+	f.hold = f.hold[:0]
+}
+
+func (f *ImageFilter) body(c byte) {
+	if f.image != nil {
+		if len(f.image) < maxImageSize {
+			f.image = append(f.image, c)
+		} else {
+			f.image = nil
+		}
+	}
+	if !f.strip {
+		f.out = append(f.out, c)
+	}
+}
+
+func (f *ImageFilter) end() {
+	if f.image != nil && f.onImage != nil {
+		f.onImage(Image{Protocol: f.protocol, Sequence: f.image})
+	}
+	f.image = nil
+	f.state = imageGround
+}
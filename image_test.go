@@ -0,0 +1,104 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestImageFilter(t *testing.T) {
+	const (
+		sixel  = "\x1bP0;1;0q#0;2;0;0;0#0~~@@\x1b\\"
+		iterm2 = "\x1b]1337;File=inline=1:AAAA\x07"
+		kitty  = "\x1b_Gf=100,a=T;AAAA\x1b\\"
+	)
+	type image struct {
+		protocol ImageProtocol
+		sequence string
+	}
+	for _, tc := range []struct {
+		name     string
+		in       string
+		images   []image
+		stripped string
+	}{
+		{"text", "hello\r\n", nil, "hello\r\n"},
+		{"sixel", "a" + sixel + "b", []image{{ImageSixel, sixel}}, "ab"},
+		{"iterm2 BEL", "a" + iterm2 + "b", []image{{ImageITerm2, iterm2}}, "ab"},
+		{"iterm2 ST", "a\x1b]1337;File=:AA\x1b\\b", []image{{ImageITerm2, "\x1b]1337;File=:AA\x1b\\"}}, "ab"},
+		{"kitty", "a" + kitty + "b", []image{{ImageKitty, kitty}}, "ab"},
+		{"several", sixel + "\r\n" + kitty + iterm2, []image{{ImageSixel, sixel}, {ImageKitty, kitty}, {ImageITerm2, iterm2}}, "\r\n"},
+		{"CSI", "\x1b[31mred\x1b[0m", nil, "\x1b[31mred\x1b[0m"},
+		{"OSC title", "\x1b]0;title\x07x", nil, "\x1b]0;title\x07x"},
+		{"OSC 1337 without file", "\x1b]1337;SetMark\x07x", nil, "\x1b]1337;SetMark\x07x"},
+		{"DCS query", "\x1bP+q544e\x1b\\x", nil, "\x1bP+q544e\x1b\\x"},
+		{"APC", "\x1b_X\x1b\\x", nil, "\x1b_X\x1b\\x"},
+		{"escape before image", "\x1b\x1bPq~\x1b\\", []image{{ImageSixel, "\x1bPq~\x1b\\"}}, "\x1b"},
+		// the image is dropped, the sequence cancelling it isn't
+		{"cancelled", "\x1bPq~~\x1b[0mx", nil, "\x1b[0mx"},
+		{"cut off", "a\x1b]1337;Fi", nil, "a\x1b]1337;Fi"},
+		{"cut off after ESC", "\x1bPq\x1b", nil, ""},
+	} {
+		for _, strip := range []bool{false, true} {
+			want := tc.in
+			if strip {
+				want = tc.stripped
+			}
+			for split, r := range map[string]io.Reader{
+				"whole":    strings.NewReader(tc.in),
+				"one byte": iotest.OneByteReader(strings.NewReader(tc.in)),
+			} {
+				var images []image
+				out, err := io.ReadAll(NewImageFilter(r, func(i Image) {
+					images = append(images, image{i.Protocol, string(i.Sequence)})
+				}, strip))
+				if err != nil || string(out) != want {
+					t.Errorf("%s, strip %t, %s: got %q, %v, want %q", tc.name, strip, split, out, err, want)
+				}
+				if len(images) != len(tc.images) {
+					t.Errorf("%s, strip %t, %s: got images %q, want %q", tc.name, strip, split, images, tc.images)
+					continue
+				}
+				for i := range images {
+					if images[i] != tc.images[i] {
+						t.Errorf("%s, strip %t, %s: got image %q, want %q", tc.name, strip, split, images[i], tc.images[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func FuzzImageFilter(f *testing.F) {
+	for _, seed := range []string{
+		"\x1bP0;1;0q#0~~\x1b\\",
+		"\x1b]1337;File=inline=1:AAAA\x07",
+		"\x1b_Gf=100;AAAA\x1b\\",
+		"\x1b]0;title\x07\x1b[31m",
+		"\x1bPq\x1b",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		// without strip every byte is passed on, however it is split
+		for _, r := range []io.Reader{bytes.NewReader(in), iotest.OneByteReader(bytes.NewReader(in))} {
+			out, err := io.ReadAll(NewImageFilter(r, nil, false))
+			if err != nil || !bytes.Equal(out, in) {
+				t.Fatalf("got %q, %v, want %q", out, err, in)
+			}
+		}
+		out, err := io.ReadAll(NewImageFilter(bytes.NewReader(in), func(i Image) {
+			if !bytes.Contains(in, i.Sequence) {
+				t.Errorf("image %q not in %q", i.Sequence, in)
+			}
+		}, true))
+		if err != nil || len(out) > len(in) {
+			t.Fatalf("stripped: got %q, %v from %q", out, err, in)
+		}
+	})
+}
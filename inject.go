@@ -0,0 +1,132 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Injector merges host generated content, like welcome banners and reconnect
+// notices, into the output of a pty. It isn't written to the child, but everything
+// reading through the Injector, recorders included, sees it in order with the
+// child's output.
+type Injector struct {
+	// Clock InjectExitSummary measures with, nil is the system clock.
+	Clock Clock
+
+	stream  *Stream
+	scanner vtScanner
+	out     []byte
+	err     error
+
+	mu    sync.Mutex
+	queue [][]byte
+	wake  chan struct{}
+}
+
+// Read r, usually the reader of a pty, in the background so content can be
+// injected while the child is quiet.
+func NewInjector(r io.Reader) *Injector {
+	return &Injector{
+		stream: NewStream(r, DefaultStreamOptions()),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Stop reading the pty and return its reader, see Stream.Stop.
+// Read then returns io.EOF once the output read so far and the injected content
+// were delivered.
+func (i *Injector) Stop() io.Reader {
+	return i.stream.Stop()
+}
+
+// Queue b for the output. It is delivered between control sequences of the child,
+// never in the middle of one.
+func (i *Injector) Inject(b []byte) {
+	i.mu.Lock()
+	i.queue = append(i.queue, append([]byte(nil), b...))
+	i.mu.Unlock()
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (i *Injector) take() []byte {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.queue) == 0 {
+		return nil
+	}
+	b := i.queue[0]
+	i.queue = i.queue[1:]
+	return b
+}
+
+// Content injected after the child's output ended is still delivered before io.EOF.
+func (i *Injector) Read(b []byte) (int, error) {
+	for len(i.out) == 0 {
+		// a sequence cut off by the end of the output never completes
+		boundary := i.scanner.state == vtGround || i.err != nil
+		if boundary {
+			if injected := i.take(); injected != nil {
+				i.out = injected
+				break
+			}
+		}
+		if i.err != nil {
+			return 0, i.err
+		}
+
+		var wake <-chan struct{}
+		if boundary {
+			wake = i.wake
+		}
+		select {
+		case chunk, ok := <-i.stream.Output():
+			if !ok {
+				i.err = i.stream.Err()
+				if i.err == nil {
+					i.err = io.EOF
+				}
+				continue
+			}
+			i.scanner.scan(chunk, func(vtSequence) {})
+			i.out = append(i.out[:0], chunk...)
+			i.stream.Release(chunk)
+		case <-wake:
+		}
+	}
+	n := copy(b, i.out)
+	i.out = i.out[n:]
+	return n, nil
+}
+
+// Formats the line InjectExitSummary adds, err is the error Wait returned.
+type ExitSummaryFunc func(code uint32, elapsed time.Duration, err error) string
+
+func DefaultExitSummary(code uint32, elapsed time.Duration, err error) string {
+	if err != nil {
+		return fmt.Sprintf("\r\nprocess exited: %v\r\n", err)
+	}
+	return fmt.Sprintf("\r\nprocess exited with code %d after %s\r\n", code, elapsed.Round(time.Second))
+}
+
+// Inject a summary line once child exits, started is when it was spawned.
+// A nil format uses DefaultExitSummary.
+// Output the child printed right before exiting can still be in flight and end up
+// after the summary.
+func (i *Injector) InjectExitSummary(child Child, started time.Time, format ExitSummaryFunc) {
+	if format == nil {
+		format = DefaultExitSummary
+	}
+	go func() {
+		code, err := child.Wait()
+		elapsed := clockOrSystem(i.Clock).Now().Sub(started)
+		i.Inject([]byte(format(code, elapsed, err)))
+	}()
+}
@@ -0,0 +1,108 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty_test
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+	"github.com/UfukUstali/go-pty/ptytest"
+)
+
+// Start script in a virtual pty and return an Injector on its output and its writer.
+func injectorFor(t *testing.T, script ptytest.Script) (pty.Pty, pty.Child, *pty.Injector, io.Writer) {
+	t.Helper()
+	p := ptytest.NewVirtualPty(pty.DefaultPtySize(), script)
+	t.Cleanup(func() { p.Close() })
+	r, _ := p.TakeReader()
+	w, _ := p.TakeWriter()
+	child, err := p.SpawnCommand(exec.Command("sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, child, pty.NewInjector(r), w
+}
+
+func read(t *testing.T, r io.Reader, want string) {
+	t.Helper()
+	buffer := make([]byte, 64)
+	n, err := r.Read(buffer)
+	if err != nil || string(buffer[:n]) != want {
+		t.Fatalf("got %q, %v, want %q", buffer[:n], err, want)
+	}
+}
+
+// Injected content waits until the sequence the child is in the middle of ended.
+func TestInjectorWaitsForSequenceEnd(t *testing.T) {
+	_, _, injector, w := injectorFor(t, ptytest.Script{Steps: []ptytest.Step{
+		{Output: "\x1b[3"},
+		{Expect: "go", Output: "1mred"},
+	}})
+
+	read(t, injector, "\x1b[3")
+	injector.Inject([]byte("X"))
+	w.Write([]byte("go"))
+	read(t, injector, "1mred")
+	read(t, injector, "X")
+}
+
+// Injections still pending when the output ends are delivered before the error,
+// even if the output ended in the middle of a sequence.
+func TestInjectorDeliversBeforeEnd(t *testing.T) {
+	p, _, injector, _ := injectorFor(t, ptytest.Script{Steps: []ptytest.Step{
+		{Output: "bye\x1b[3"},
+	}})
+
+	read(t, injector, "bye\x1b[3")
+	injector.Inject([]byte("first"))
+	p.Close()
+	injector.Inject([]byte("second"))
+	read(t, injector, "first")
+	read(t, injector, "second")
+	if _, err := injector.Read(make([]byte, 16)); !errors.Is(err, pty.ErrPtyClosed) {
+		t.Errorf("got %v, want ErrPtyClosed", err)
+	}
+}
+
+// The summary is injected once the child exited, timed on the injector's clock.
+func TestInjectExitSummary(t *testing.T) {
+	clock := ptytest.NewFakeClock(time.Unix(0, 0))
+	_, child, injector, w := injectorFor(t, ptytest.Script{
+		Steps:    []ptytest.Step{{Output: "working"}, {Expect: "quit"}},
+		ExitCode: 3,
+	})
+	injector.Clock = clock
+
+	injector.InjectExitSummary(child, clock.Now(), func(code uint32, elapsed time.Duration, err error) string {
+		if _, exited := child.Exited(); exited != nil {
+			t.Errorf("summary made before the child exited: %v", exited)
+		}
+		return pty.DefaultExitSummary(code, elapsed, err)
+	})
+	read(t, injector, "working")
+	clock.Advance(90 * time.Second)
+	w.Write([]byte("quit"))
+	read(t, injector, "\r\nprocess exited with code 3 after 1m30s\r\n")
+}
+
+func TestDefaultExitSummary(t *testing.T) {
+	for _, tc := range []struct {
+		code    uint32
+		elapsed time.Duration
+		err     error
+		want    string
+	}{
+		{0, 1400 * time.Millisecond, nil, "\r\nprocess exited with code 0 after 1s\r\n"},
+		{1, time.Hour + 1600*time.Millisecond, nil, "\r\nprocess exited with code 1 after 1h0m2s\r\n"},
+		{0, time.Second, errors.New("wait failed"), "\r\nprocess exited: wait failed\r\n"},
+	} {
+		if got := pty.DefaultExitSummary(tc.code, tc.elapsed, tc.err); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
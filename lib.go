@@ -1,17 +1,20 @@
 //go:build linux || darwin || windows
 // +build linux darwin windows
 
-package lib
+package pty
 
 import (
 	"errors"
 	"io"
+	"math"
 	"os/exec"
 )
 
 type PtySize struct {
-	Rows        uint16
-	Cols        uint16
+	Rows uint16
+	Cols uint16
+	// Size of the whole text area in pixels, 0 if unknown.
+	// Windows can't pass them to the child, use a Responder to answer pixel size queries.
 	PixelWidth  uint16
 	PixelHeight uint16
 }
@@ -25,31 +28,92 @@ func DefaultPtySize() PtySize {
 	}
 }
 
-type Pty interface {
+// Size of rows x cols cells that are cellWidth x cellHeight logical pixels on a
+// display with the given scale factor, e.g. devicePixelRatio in browsers.
+// The pixel size is in device pixels, so image protocols can scale images correctly
+// on HiDPI displays, and always a whole number of cells.
+func SizeFromCells(rows, cols uint16, cellWidth, cellHeight, scale float64) PtySize {
+	if scale <= 0 {
+		scale = 1
+	}
+	return PtySize{
+		Rows:        rows,
+		Cols:        cols,
+		PixelWidth:  uint16(min(math.Round(cellWidth*scale)*float64(cols), math.MaxUint16)),
+		PixelHeight: uint16(min(math.Round(cellHeight*scale)*float64(rows), math.MaxUint16)),
+	}
+}
+
+// Size of a cell in pixels, 0 if unknown.
+func (s PtySize) CellSize() (width, height uint16) {
+	if s.PixelWidth == 0 || s.PixelHeight == 0 || s.Rows == 0 || s.Cols == 0 {
+		return 0, 0
+	}
+	return s.PixelWidth / s.Cols, s.PixelHeight / s.Rows
+}
+
+// Backend is the byte stream side of a terminal: the pty of a local process, or
+// anything else a terminal can be attached to, like a remote shell, a serial line
+// or a mock. Code that only moves bytes and sizes should take a Backend.
+type Backend interface {
 	// Resize the window size for the pty
 	Resize(size PtySize) error
 
-	// Get the size of the pty
+	// Get the size of the pty.
+	// Returns the last known size together with ErrSizeDiverged if the pty might be at
+	// a different size, e.g. because the last resize failed.
 	GetSize() (PtySize, error)
 
 	// Get a reader that reads from the pty.
 	// Recommended to be used with a bufio.Reader in it's own goroutine.
+	// Returns io.EOF once the output ended (Windows: the pipe broke or is being closed),
+	// ErrPtyClosed if the pty was closed under it and ErrIO for anything unexpected.
 	TakeReader() (io.Reader, error)
 
 	// Get a writer that writes to the pty.
 	// Recommended to be used in it's own goroutine.
+	// Returns ErrChildExited once nobody reads the input anymore (Windows: the pipe broke
+	// while the pty was open), ErrPtyClosed if the pty was closed under it, a write
+	// in flight during Close included, and ErrIO for anything unexpected.
 	TakeWriter() (io.Writer, error)
 
-	// Spawn a command in the pty
-	SpawnCommand(cmd *exec.Cmd) (Child, error)
+	// Give back a reader taken with TakeReader so it can be taken again,
+	// e.g. by the next client after the previous one disconnected.
+	// It must not be used anymore afterwards.
+	ReturnReader(r io.Reader) error
+
+	// Give back a writer taken with TakeWriter so it can be taken again.
+	// It must not be used anymore afterwards.
+	ReturnWriter(w io.Writer) error
+
+	// Closed once the pty is closed, so work tied to it, like forwarding host
+	// resizes, can stop right away.
+	Done() <-chan struct{}
 
 	// Close the pty.
 	// Make sure to stop reading and writing before calling this.
+	// Readers and writers taken from the pty return ErrPtyClosed afterwards.
 	// This has to be called to free resources after Child.Wait and/or Child.Kill.
 	// Multiple calls to Close is fine.
 	Close() error
 }
 
+// Pty is a Backend that local processes are spawned in.
+type Pty interface {
+	Backend
+
+	// Spawn a command in the pty.
+	// Fields of cmd that can't be honored, like Stdin or ExtraFiles, fail with ErrUnsupportedField.
+	// A lookup exec.Command failed, e.g. with exec.ErrDot, returns cmd.Err.
+	SpawnCommand(cmd *exec.Cmd, opts ...SpawnOption) (Child, error)
+
+	// Spawn path in the pty without going through exec.Cmd.
+	// args includes argv[0], on Windows the command line is built from it with the
+	// quoting rules of CommandLineToArgvW unless WithCommandLine is given.
+	// A nil env means the environment of the current process.
+	SpawnArgs(path string, args []string, env []string, dir string, opts ...SpawnOption) (Child, error)
+}
+
 type Child interface {
 	// Non-blocking check if the child has exited.
 	// The first return value is the exit code but if there is no error.
@@ -58,14 +122,39 @@ type Child interface {
 
 	// Block until the child process exits.
 	// The first return value is the exit code but is only valid if there is no error.
+	// Safe to call from multiple goroutines and more than once, all calls get the same result.
 	Wait() (uint32, error)
 
 	// Terminate the child process
 	Kill() error
+
+	// Free the resources held for the child, on Windows its process handle.
+	// The caller owns the child and should release it once done with it, usually
+	// after Wait. The child keeps running if it hasn't exited, only the ability to
+	// wait on or kill it is given up.
+	// Blocks while a Wait on a running child is in progress. Afterwards Exited, Kill and
+	// Wait fail with ErrAlreadyClosed unless Wait already returned, then its result is kept.
+	Release() error
 }
 
 var ErrNotFinished = errors.New("not finished")
 
 var ErrAlreadyTaken = errors.New("already taken")
 
+var ErrNotTaken = errors.New("not taken")
+
 var ErrAlreadyClosed = errors.New("already closed")
+
+var ErrAlreadySpawned = errors.New("already spawned")
+
+var ErrPtyClosed = errors.New("pty closed")
+
+var ErrSizeDiverged = errors.New("size diverged")
+
+// Wrapped around the name of exec.Cmd fields SpawnCommand can't honor, check with errors.Is.
+var ErrUnsupportedField = errors.New("unsupported exec.Cmd field")
+
+var ErrChildExited = errors.New("child exited")
+
+// Wrapped around unexpected errors of the reader and writer, check with errors.Is.
+var ErrIO = errors.New("pty i/o error")
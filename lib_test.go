@@ -0,0 +1,47 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import "testing"
+
+func TestSizeFromCells(t *testing.T) {
+	for _, tc := range []struct {
+		rows, cols            uint16
+		cellWidth, cellHeight float64
+		scale                 float64
+		want                  PtySize
+	}{
+		{24, 80, 8, 16, 1, PtySize{Rows: 24, Cols: 80, PixelWidth: 640, PixelHeight: 384}},
+		{24, 80, 8, 16, 1.5, PtySize{Rows: 24, Cols: 80, PixelWidth: 960, PixelHeight: 576}},
+		// cells are rounded to whole device pixels before multiplying
+		{24, 80, 7.5, 15.4, 1, PtySize{Rows: 24, Cols: 80, PixelWidth: 640, PixelHeight: 360}},
+		{10, 10, 8.3, 16.6, 1.25, PtySize{Rows: 10, Cols: 10, PixelWidth: 100, PixelHeight: 210}},
+		// no scale is 1
+		{24, 80, 8, 16, 0, PtySize{Rows: 24, Cols: 80, PixelWidth: 640, PixelHeight: 384}},
+		{24, 80, 8, 16, -2, PtySize{Rows: 24, Cols: 80, PixelWidth: 640, PixelHeight: 384}},
+		{24, 80, 0, 0, 2, PtySize{Rows: 24, Cols: 80}},
+		{1000, 1000, 100, 100, 1, PtySize{Rows: 1000, Cols: 1000, PixelWidth: 65535, PixelHeight: 65535}},
+	} {
+		if got := SizeFromCells(tc.rows, tc.cols, tc.cellWidth, tc.cellHeight, tc.scale); got != tc.want {
+			t.Errorf("%dx%d of %gx%g at %g: got %+v, want %+v", tc.rows, tc.cols, tc.cellWidth, tc.cellHeight, tc.scale, got, tc.want)
+		}
+	}
+}
+
+func TestCellSize(t *testing.T) {
+	for _, tc := range []struct {
+		size          PtySize
+		width, height uint16
+	}{
+		{PtySize{Rows: 24, Cols: 80, PixelWidth: 640, PixelHeight: 384}, 8, 16},
+		{PtySize{Rows: 24, Cols: 80, PixelWidth: 655, PixelHeight: 390}, 8, 16},
+		{DefaultPtySize(), 0, 0},
+		{PtySize{Rows: 24, Cols: 80, PixelWidth: 640}, 0, 0},
+		{PtySize{Cols: 80, PixelWidth: 640, PixelHeight: 384}, 0, 0},
+	} {
+		if width, height := tc.size.CellSize(); width != tc.width || height != tc.height {
+			t.Errorf("%+v: got %dx%d, want %dx%d", tc.size, width, height, tc.width, tc.height)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package pty
+
+import (
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// Make cmd start a login shell so the profile files of the user are sourced.
+// argv[0] gets prefixed with '-' and HOME, USER and LOGNAME are set for the user
+// the child runs as, which is taken from cmd.SysProcAttr.Credential if set.
+// cmd.Dir defaults to the home directory of that user.
+func LoginShell(cmd *exec.Cmd) error {
+	u, err := user.Current()
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		u, err = user.LookupId(strconv.FormatUint(uint64(cmd.SysProcAttr.Credential.Uid), 10))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(cmd.Args) == 0 {
+		cmd.Args = []string{cmd.Path}
+	}
+	cmd.Args[0] = "-" + filepath.Base(cmd.Path)
+
+	env := cmdEnv(cmd.Env)
+	env = setEnv(env, "HOME", u.HomeDir)
+	env = setEnv(env, "USER", u.Username)
+	env = setEnv(env, "LOGNAME", u.Username)
+	cmd.Env = env
+
+	if cmd.Dir == "" {
+		cmd.Dir = u.HomeDir
+	}
+	return nil
+}
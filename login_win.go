@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Make cmd start a login shell so the profile files of the user are sourced.
+// argv[0] is not passed to the child on Windows, so `--login` is added for
+// sh-like shells (e.g. Git Bash). Other shells are left as is.
+// cmd.Dir defaults to the profile directory of the user.
+func LoginShell(cmd *exec.Cmd) error {
+	if len(cmd.Args) == 0 {
+		cmd.Args = []string{cmd.Path}
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(cmd.Path)), ".exe")
+	switch name {
+	case "bash", "sh", "zsh", "fish":
+		cmd.Args = append([]string{cmd.Args[0], "--login"}, cmd.Args[1:]...)
+	}
+
+	if cmd.Dir == "" {
+		if home, ok := lookupEnv(cmdEnv(cmd.Env), "USERPROFILE"); ok {
+			cmd.Dir = home
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import "io"
+
+type NewlineMode int
+
+const (
+	// LF and CRLF become CR, which is what children in raw mode expect for Enter.
+	LFToCR NewlineMode = iota
+	// CRLF becomes LF and lone CRs are kept, for capturing output to logs.
+	// A CR at the end of a read or write is held back until the next byte is known.
+	CRLFToLF
+	// Lone LFs become CRLF.
+	LFToCRLF
+)
+
+type newlineTranslator struct {
+	mode NewlineMode
+	// last byte was a CR
+	lastCR bool
+	// CR held back by CRLFToLF
+	pendingCR bool
+}
+
+func (t *newlineTranslator) translate(dst []byte, src []byte) []byte {
+	for _, c := range src {
+		dst = t.translateByte(dst, c)
+	}
+	return dst
+}
+
+func (t *newlineTranslator) translateByte(dst []byte, c byte) []byte {
+	switch t.mode {
+	case LFToCR:
+		if c != '\n' {
+			dst = append(dst, c)
+		} else if !t.lastCR {
+			dst = append(dst, '\r')
+		}
+	case LFToCRLF:
+		if c == '\n' && !t.lastCR {
+			dst = append(dst, '\r')
+		}
+		dst = append(dst, c)
+	case CRLFToLF:
+		if t.pendingCR {
+			t.pendingCR = false
+			if c != '\n' {
+				dst = append(dst, '\r')
+			}
+		}
+		if c == '\r' {
+			t.pendingCR = true
+		} else {
+			dst = append(dst, c)
+		}
+	}
+	t.lastCR = c == '\r'
+	return dst
+}
+
+func (t *newlineTranslator) flush(dst []byte) []byte {
+	if t.pendingCR {
+		t.pendingCR = false
+		dst = append(dst, '\r')
+	}
+	return dst
+}
+
+type newlineReader struct {
+	r   io.Reader
+	t   newlineTranslator
+	buf []byte
+	out []byte
+	err error
+}
+
+// Translate newlines in everything read from r, e.g. the output of a pty.
+func NewNewlineReader(r io.Reader, mode NewlineMode) io.Reader {
+	return &newlineReader{
+		r:   r,
+		t:   newlineTranslator{mode: mode},
+		buf: make([]byte, 4096),
+	}
+}
+
+func (r *newlineReader) Read(b []byte) (int, error) {
+	for len(r.out) == 0 && r.err == nil {
+		n, err := r.r.Read(r.buf)
+		r.out = r.t.translate(r.out, r.buf[:n])
+		if err != nil {
+			r.out = r.t.flush(r.out)
+			r.err = err
+		}
+	}
+	if len(r.out) == 0 {
+		return 0, r.err
+	}
+	n := copy(b, r.out)
+	r.out = r.out[:copy(r.out, r.out[n:])]
+	return n, nil
+}
+
+// NewlineWriter translates newlines in everything written to it.
+type NewlineWriter struct {
+	w   io.Writer
+	t   newlineTranslator
+	out []byte
+	// input byte every byte of out was translated from
+	owners []int
+	// translator state before every input byte, to resume after a short write
+	states []newlineTranslator
+}
+
+// Translate newlines in everything written to w, e.g. the input of a pty.
+// Call Flush once done, CRLFToLF holds back a CR at the end of a write until the
+// next byte is known.
+func NewNewlineWriter(w io.Writer, mode NewlineMode) *NewlineWriter {
+	return &NewlineWriter{
+		w: w,
+		t: newlineTranslator{mode: mode},
+	}
+}
+
+// If w fails part way, the returned count only includes bytes whose translation
+// was written completely, writing the rest again continues where it stopped.
+func (w *NewlineWriter) Write(b []byte) (int, error) {
+	w.out = w.out[:0]
+	w.owners = w.owners[:0]
+	w.states = w.states[:0]
+	for i, c := range b {
+		w.states = append(w.states, w.t)
+		before := len(w.out)
+		w.out = w.t.translateByte(w.out, c)
+		for range w.out[before:] {
+			w.owners = append(w.owners, i)
+		}
+	}
+	if len(w.out) == 0 {
+		return len(b), nil
+	}
+
+	n, err := w.w.Write(w.out)
+	if n < len(w.out) {
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		written := w.owners[n]
+		w.t = w.states[written]
+		if n > 0 && w.owners[n-1] == written {
+			// only the CR its translation starts with made it, don't send it again
+			w.t.lastCR = true
+			w.t.pendingCR = false
+		}
+		return written, err
+	}
+	return len(b), err
+}
+
+// Write a CR held back by CRLFToLF.
+func (w *NewlineWriter) Flush() error {
+	w.out = w.t.flush(w.out[:0])
+	if len(w.out) == 0 {
+		return nil
+	}
+	if _, err := w.w.Write(w.out); err != nil {
+		// keep it for the next attempt
+		w.t.pendingCR = true
+		return err
+	}
+	return nil
+}
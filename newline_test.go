@@ -0,0 +1,100 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewlineReader(t *testing.T) {
+	for _, tc := range []struct {
+		mode NewlineMode
+		in   string
+		want string
+	}{
+		{LFToCR, "a\nb\r\nc", "a\rb\rc"},
+		{CRLFToLF, "a\r\nb\rc\r", "a\nb\rc\r"},
+		{LFToCRLF, "a\nb\r\n", "a\r\nb\r\n"},
+	} {
+		got, err := io.ReadAll(NewNewlineReader(strings.NewReader(tc.in), tc.mode))
+		if err != nil || string(got) != tc.want {
+			t.Errorf("mode %d %q: got %q, %v, want %q", tc.mode, tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestNewlineWriterFlush(t *testing.T) {
+	var out bytes.Buffer
+	w := NewNewlineWriter(&out, CRLFToLF)
+	w.Write([]byte("progress 50%\r"))
+	if out.String() != "progress 50%" {
+		t.Fatalf("before Flush: got %q", out.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "progress 50%\r" {
+		t.Errorf("after Flush: got %q", out.String())
+	}
+	w.Write([]byte("\n"))
+	if out.String() != "progress 50%\r\n" {
+		t.Errorf("LF after a flushed CR: got %q", out.String())
+	}
+}
+
+var errFull = errors.New("full")
+
+// Accepts limit bytes, then fails.
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		n, _ := w.Buffer.Write(b[:w.limit])
+		w.limit = 0
+		return n, errFull
+	}
+	w.limit -= len(b)
+	return w.Buffer.Write(b)
+}
+
+func TestNewlineWriterShortWrite(t *testing.T) {
+	for _, tc := range []struct {
+		mode  NewlineMode
+		in    string
+		limit int
+		n     int
+		want  string
+	}{
+		// "ab\r\ncd": the CR of the translated LF made it
+		{LFToCRLF, "ab\ncd", 3, 2, "ab\r\ncd"},
+		{LFToCRLF, "ab\ncd", 2, 2, "ab\r\ncd"},
+		{LFToCR, "ab\r\ncd", 3, 4, "ab\rcd"},
+		// the held back CR goes out in front of the byte after it
+		{CRLFToLF, "ab\rcd", 3, 3, "ab\rcd"},
+	} {
+		out := &limitedWriter{limit: tc.limit}
+		w := NewNewlineWriter(out, tc.mode)
+		in := []byte(tc.in)
+		n, err := w.Write(in)
+		if !errors.Is(err, errFull) || n != tc.n {
+			t.Errorf("mode %d %q: got %d, %v, want %d, %v", tc.mode, tc.in, n, err, tc.n, errFull)
+			continue
+		}
+		out.limit = 100
+		if _, err := w.Write(in[n:]); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if out.String() != tc.want {
+			t.Errorf("mode %d %q after retry: got %q, want %q", tc.mode, tc.in, out.String(), tc.want)
+		}
+	}
+}
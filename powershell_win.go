@@ -0,0 +1,74 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"os/exec"
+	"unicode/utf16"
+)
+
+type PowerShellOptions struct {
+	// Executable to run. Empty means pwsh.exe if it is on the PATH, powershell.exe otherwise.
+	Path string
+
+	// Skip the profile scripts, for predictable automation.
+	NoProfile bool
+
+	// Execution policy for this process only, e.g. "Bypass". Empty keeps the configured one.
+	ExecutionPolicy string
+
+	// Script to run. Empty starts an interactive shell.
+	Command string
+
+	// Keep the shell open after Command ran.
+	NoExit bool
+
+	Dir string
+}
+
+// Build the command for a PowerShell child with flags suited for a pty.
+// Command is passed with -EncodedCommand, so it never goes through the quoting
+// rules of the command line.
+func PowerShell(opts PowerShellOptions) (*exec.Cmd, error) {
+	path := opts.Path
+	if path == "" {
+		var err error
+		if path, err = exec.LookPath("pwsh.exe"); err != nil {
+			if path, err = exec.LookPath("powershell.exe"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cmd := exec.Command(path, "-NoLogo")
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	if opts.NoProfile {
+		cmd.Args = append(cmd.Args, "-NoProfile")
+	}
+	if opts.ExecutionPolicy != "" {
+		cmd.Args = append(cmd.Args, "-ExecutionPolicy", opts.ExecutionPolicy)
+	}
+	if opts.NoExit {
+		cmd.Args = append(cmd.Args, "-NoExit")
+	}
+	if opts.Command != "" {
+		cmd.Args = append(cmd.Args, "-EncodedCommand", encodePowerShell(opts.Command))
+	}
+	cmd.Dir = opts.Dir
+	return cmd, nil
+}
+
+// Base64 of the UTF-16LE script, which is what -EncodedCommand expects.
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], unit)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
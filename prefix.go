@@ -0,0 +1,99 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"io"
+)
+
+type prefixReader struct {
+	r      io.Reader
+	prefix func() string
+	buf    []byte
+	out    []byte
+	err    error
+
+	scanner vtScanner
+	// cursor is at the start of a line, after a LF or a CR
+	atStart bool
+	// the alternate screen is up, full-screen programs don't have lines to prefix
+	alt bool
+}
+
+// Prefix every line read from r with the result of prefix, e.g. to tell sessions
+// apart in an aggregated log.
+// A line rewritten after a CR gets the prefix again, so progress bars stay aligned,
+// and nothing is prefixed while the alternate screen is up.
+func NewPrefixReader(r io.Reader, prefix func() string) io.Reader {
+	return &prefixReader{
+		r:       r,
+		prefix:  prefix,
+		buf:     make([]byte, 4096),
+		atStart: true,
+	}
+}
+
+// Prefix for NewPrefixReader with the current time of clock formatted with layout.
+// A nil clock is the system clock.
+func TimestampPrefix(layout string, clock Clock) func() string {
+	clock = clockOrSystem(clock)
+	return func() string {
+		return clock.Now().Format(layout) + " "
+	}
+}
+
+func (r *prefixReader) Read(b []byte) (int, error) {
+	for len(r.out) == 0 && r.err == nil {
+		n, err := r.r.Read(r.buf)
+		r.transform(r.buf[:n])
+		r.err = err
+	}
+	if len(r.out) == 0 {
+		return 0, r.err
+	}
+	n := copy(b, r.out)
+	r.out = r.out[:copy(r.out, r.out[n:])]
+	return n, nil
+}
+
+func (r *prefixReader) transform(b []byte) {
+	for i := range b {
+		c := b[i]
+		if r.scanner.state == vtGround {
+			switch c {
+			case '\r', '\n':
+				r.atStart = true
+			default:
+				// controls and sequences in front of the text keep applying to it
+				if c >= 0x20 && c != 0x7f || c == '\t' {
+					if r.atStart && !r.alt {
+						r.out = append(r.out, r.prefix()...)
+					}
+					r.atStart = false
+				}
+			}
+		}
+		r.out = append(r.out, c)
+		r.scanner.scan(b[i:i+1], r.modes)
+	}
+}
+
+// Follow switches to and from the alternate screen.
+func (r *prefixReader) modes(seq vtSequence) {
+	if seq.kind != vtCSI || (seq.final != 'h' && seq.final != 'l') {
+		return
+	}
+	params, ok := bytes.CutPrefix(seq.params, []byte("?"))
+	if !ok {
+		return
+	}
+	for _, mode := range bytes.Split(params, []byte(";")) {
+		switch string(mode) {
+		case "47", "1047", "1049":
+			r.alt = seq.final == 'h'
+			r.atStart = true
+		}
+	}
+}
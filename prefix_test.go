@@ -0,0 +1,70 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestPrefixReader(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"lines", "a\r\nb\r\n", "> a\r\n> b\r\n"},
+		{"LF only", "a\nb", "> a\n> b"},
+		{"empty lines", "\r\n\r\nx", "\r\n\r\n> x"},
+		// a line rewritten after CR gets the prefix again
+		{"CR rewrite", "10%\r50%\rdone\r\n", "> 10%\r> 50%\r> done\r\n"},
+		// sequences in front of the text stay in front of the prefix
+		{"color", "\x1b[31mred\x1b[0m\r\n", "\x1b[31m> red\x1b[0m\r\n"},
+		{"OSC title", "\x1b]0;title\x07x", "\x1b]0;title\x07> x"},
+		{"tab", "\tx", "> \tx"},
+		{"controls", "\x07\x08x", "\x07\x08> x"},
+		{"alt screen", "a\r\n\x1b[?1049hfull\r\nscreen\x1b[?1049lb\r\n", "> a\r\n\x1b[?1049hfull\r\nscreen\x1b[?1049l> b\r\n"},
+		{"alt screen 47", "\x1b[?47hx\x1b[?47ly", "\x1b[?47hx\x1b[?47l> y"},
+		{"several modes", "\x1b[?25;1049hx\x1b[?1049;25ly", "\x1b[?25;1049hx\x1b[?1049;25l> y"},
+		{"other modes", "\x1b[?25hx\x1b[4hy", "\x1b[?25h> x\x1b[4hy"},
+	} {
+		for split, r := range map[string]io.Reader{
+			"whole":    strings.NewReader(tc.in),
+			"one byte": iotest.OneByteReader(strings.NewReader(tc.in)),
+		} {
+			out, err := io.ReadAll(NewPrefixReader(r, func() string { return "> " }))
+			if err != nil || string(out) != tc.want {
+				t.Errorf("%s, %s: got %q, %v, want %q", tc.name, split, out, err, tc.want)
+			}
+		}
+	}
+}
+
+// Reads smaller than the prefixed output still get all of it.
+func TestPrefixReaderSmallReads(t *testing.T) {
+	out, err := io.ReadAll(iotest.OneByteReader(NewPrefixReader(strings.NewReader("a\nb"), func() string { return "> " })))
+	if want := "> a\n> b"; err != nil || string(out) != want {
+		t.Errorf("got %q, %v, want %q", out, err, want)
+	}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func (c fixedClock) After(time.Duration) <-chan time.Time {
+	return nil
+}
+
+func TestTimestampPrefix(t *testing.T) {
+	prefix := TimestampPrefix("15:04:05", fixedClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+	if got := prefix(); got != "03:04:05 " {
+		t.Errorf("got %q", got)
+	}
+}
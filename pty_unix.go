@@ -1,7 +1,7 @@
 //go:build linux || darwin
 // +build linux darwin
 
-package lib
+package pty
 
 import (
 	"io"
@@ -32,11 +32,31 @@ func (p *unixPty) TakeWriter() (io.Writer, error) {
 	return nil, nil
 }
 
-func (p *unixPty) SpawnCommand(cmd *exec.Cmd) (Child, error) {
+func (p *unixPty) ReturnReader(r io.Reader) error {
+	// Unix-specific implementation
+	return nil
+}
+
+func (p *unixPty) ReturnWriter(w io.Writer) error {
+	// Unix-specific implementation
+	return nil
+}
+
+func (p *unixPty) SpawnCommand(cmd *exec.Cmd, opts ...SpawnOption) (Child, error) {
 	// Unix-specific implementation
 	return nil, nil
 }
 
+func (p *unixPty) SpawnArgs(path string, args []string, env []string, dir string, opts ...SpawnOption) (Child, error) {
+	// Unix-specific implementation
+	return nil, nil
+}
+
+func (p *unixPty) Done() <-chan struct{} {
+	// Unix-specific implementation
+	return nil
+}
+
 func (p *unixPty) Close() error {
 	// Unix-specific implementation
 	return nil
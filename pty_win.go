@@ -1,13 +1,16 @@
 //go:build windows
 // +build windows
 
-package lib
+package pty
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"runtime"
+	"sync"
 	"syscall"
 	"unsafe"
 
@@ -16,17 +19,37 @@ import (
 
 var logger = log.New(os.Stdout, "go-pty", log.Lmsgprefix|log.Lshortfile)
 
+// Closes the pipe handles in Close, replaced by tests to see when that happens.
+var closeHandle = windows.CloseHandle
+
 const (
 	PSEUDOCONSOLE_INHERIT_CURSOR   = 0x1
 	PSEUDOCONSOLE_RESIZE_QUIRK     = 0x2
 	PSEUDOCONSOLE_WIN32_INPUT_MODE = 0x4
 )
 
+// Shared by a pty and the readers and writers taken from it,
+// so they stop using the handles once the pty is closed.
+type pipeState struct {
+	// held while using the handles, Close waits for it before closing them
+	mu   sync.RWMutex
+	life lifecycle
+}
+
 type windowsReader struct {
-	read windows.Handle
+	read  windows.Handle
+	state *pipeState
 }
 
 func (r *windowsReader) Read(p []byte) (int, error) {
+	if r.state != nil {
+		r.state.mu.RLock()
+		defer r.state.mu.RUnlock()
+		if r.state.life.closed() {
+			return 0, ErrPtyClosed
+		}
+	}
+
 	var n uint32
 	// log.Info("Reading from pipe")
 	switch err := windows.ReadFile(r.read, p, &n, nil); err {
@@ -34,34 +57,99 @@ func (r *windowsReader) Read(p []byte) (int, error) {
 		return 0, io.EOF
 	case windows.ERROR_NO_DATA:
 		return 0, io.EOF
+	case windows.ERROR_INVALID_HANDLE, windows.ERROR_OPERATION_ABORTED:
+		return 0, ErrPtyClosed
 	case windows.ERROR_MORE_DATA:
 		return int(n), nil
 	case nil:
 		return int(n), nil
 	default:
 		logger.Println(err)
-		return 0, err
+		return 0, fmt.Errorf("%w: %w", ErrIO, err)
 	}
 }
 
 type windowsWriter struct {
 	write windows.Handle
+	state *pipeState
 }
 
 func (w *windowsWriter) Write(p []byte) (int, error) {
-	var n uint32
-	if err := windows.WriteFile(w.write, p, &n, nil); err != nil {
-		logger.Println(err)
-		return 0, err
+	if w.state != nil {
+		w.state.mu.RLock()
+		defer w.state.mu.RUnlock()
+		if w.state.life.closed() {
+			return 0, ErrPtyClosed
+		}
 	}
-	return int(n), nil
+
+	written := 0
+	// WriteFile can return before everything is written, keep going until it is
+	for written < len(p) {
+		var n uint32
+		err := windows.WriteFile(w.write, p[written:], &n, nil)
+		written += int(n)
+		switch err {
+		case nil:
+			if n == 0 {
+				return written, io.ErrShortWrite
+			}
+		case windows.ERROR_BROKEN_PIPE, windows.ERROR_NO_DATA:
+			// the pipe breaks when conhost goes away, which Close causes too
+			if w.state != nil && w.state.life.closed() {
+				return written, ErrPtyClosed
+			}
+			return written, ErrChildExited
+		case windows.ERROR_INVALID_HANDLE:
+			return written, ErrPtyClosed
+		default:
+			logger.Println(err)
+			return written, fmt.Errorf("%w: %w", ErrIO, err)
+		}
+	}
+	return written, nil
 }
 
 type windowsChild struct {
 	Proc windows.Handle
+	life *lifecycle
+	// the first Wait waits for the process, the result is shared with all callers
+	waitOnce sync.Once
+	done     chan struct{}
+	code     uint32
+	err      error
+	// held while Proc is used, Release closes it
+	procMu   sync.RWMutex
+	released bool
+}
+
+// Hold Proc until RUnlock, fails if the child was released.
+func (c *windowsChild) acquire(op string) error {
+	c.procMu.RLock()
+	if c.released {
+		c.procMu.RUnlock()
+		return &StateError{Op: op, State: "released", Err: ErrAlreadyClosed}
+	}
+	return nil
 }
 
 func (c *windowsChild) Exited() (uint32, error) {
+	select {
+	case <-c.done:
+		if c.err == nil {
+			return c.code, nil
+		}
+	default:
+	}
+
+	if err := c.acquire("exited"); err != nil {
+		return 0, err
+	}
+	defer c.procMu.RUnlock()
+	return c.exitCode()
+}
+
+func (c *windowsChild) exitCode() (uint32, error) {
 	var status uint32
 	if err := windows.GetExitCodeProcess(c.Proc, &status); err != nil {
 		logger.Println(err)
@@ -76,22 +164,44 @@ func (c *windowsChild) Exited() (uint32, error) {
 }
 
 func (c *windowsChild) Wait() (uint32, error) {
-	if c.Proc == windows.InvalidHandle {
-		return 0, ErrAlreadyClosed
+	c.waitOnce.Do(func() {
+		c.code, c.err = c.wait()
+		close(c.done)
+	})
+	<-c.done
+	return c.code, c.err
+}
+
+func (c *windowsChild) wait() (uint32, error) {
+	if err := c.life.checkChild("wait"); err != nil {
+		return 0, err
 	}
+	if err := c.acquire("wait"); err != nil {
+		return 0, err
+	}
+	defer c.procMu.RUnlock()
 	if _, err := windows.WaitForSingleObject(c.Proc, windows.INFINITE); err != nil {
 		logger.Println(err)
 		return 0, err
 	}
-	code, err := c.Exited()
-	c.Proc = windows.InvalidHandle
-	return code, err
+	code, err := c.exitCode()
+	if err != nil {
+		return 0, err
+	}
+	if err := c.life.exit("wait"); err != nil {
+		return 0, err
+	}
+	return code, nil
 }
 
 func (c *windowsChild) Kill() error {
-	if c.Proc == windows.InvalidHandle {
-		return ErrAlreadyClosed
+	if err := c.life.checkChild("kill"); err != nil {
+		return err
+	}
+	if err := c.acquire("kill"); err != nil {
+		return err
 	}
+	defer c.procMu.RUnlock()
 	if err := windows.TerminateProcess(c.Proc, 1); err != nil {
 		logger.Println(err)
 		return err
@@ -99,34 +209,71 @@ func (c *windowsChild) Kill() error {
 	return nil
 }
 
+func (c *windowsChild) Release() error {
+	c.procMu.Lock()
+	defer c.procMu.Unlock()
+	if c.released {
+		return &StateError{Op: "release", State: "released", Err: ErrAlreadyClosed}
+	}
+	c.released = true
+	runtime.SetFinalizer(c, nil)
+	if err := windows.CloseHandle(c.Proc); err != nil {
+		logger.Println(err)
+		return err
+	}
+	return nil
+}
+
 type windowsPty struct {
-	PCon        windows.Handle
+	PCon   windows.Handle
+	sizeMu sync.Mutex
+	// set when a resize failed, the console might be at either size
+	sizeUnknown bool
 	PtySize     PtySize
+	takeMu      sync.Mutex
 	Readable    *windowsReader
 	readHandle  windows.Handle
 	Writable    *windowsWriter
 	writeHandle windows.Handle
-	closed      bool
+	state       *pipeState
 }
 
 func (p *windowsPty) Resize(size PtySize) error {
+	if err := p.state.life.check("resize"); err != nil {
+		return err
+	}
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
 	if err := windows.ResizePseudoConsole(
 		p.PCon,
 		windows.Coord{X: int16(size.Cols), Y: int16(size.Rows)},
 	); err != nil {
+		p.sizeUnknown = true
 		logger.Println(err)
 		return err
 	}
 
 	p.PtySize = size
+	p.sizeUnknown = false
 	return nil
 }
 
 func (p *windowsPty) GetSize() (PtySize, error) {
+	p.sizeMu.Lock()
+	defer p.sizeMu.Unlock()
+	// ConPTY has no way to query the size, so only the last successful resize is known
+	if p.sizeUnknown {
+		return p.PtySize, ErrSizeDiverged
+	}
 	return p.PtySize, nil
 }
 
 func (p *windowsPty) TakeReader() (io.Reader, error) {
+	if err := p.state.life.check("take reader"); err != nil {
+		return nil, err
+	}
+	p.takeMu.Lock()
+	defer p.takeMu.Unlock()
 	if p.Readable == nil {
 		return nil, ErrAlreadyTaken
 	}
@@ -137,6 +284,11 @@ func (p *windowsPty) TakeReader() (io.Reader, error) {
 }
 
 func (p *windowsPty) TakeWriter() (io.Writer, error) {
+	if err := p.state.life.check("take writer"); err != nil {
+		return nil, err
+	}
+	p.takeMu.Lock()
+	defer p.takeMu.Unlock()
 	if p.Writable == nil {
 		return nil, ErrAlreadyTaken
 	}
@@ -146,15 +298,131 @@ func (p *windowsPty) TakeWriter() (io.Writer, error) {
 	return temp, nil
 }
 
-func (p *windowsPty) SpawnCommand(cmd *exec.Cmd) (Child, error) {
+func (p *windowsPty) ReturnReader(r io.Reader) error {
+	if err := p.state.life.check("return reader"); err != nil {
+		return err
+	}
+	p.takeMu.Lock()
+	defer p.takeMu.Unlock()
+	reader, ok := r.(*windowsReader)
+	if p.Readable != nil || !ok || reader.read != p.readHandle || reader.state != p.state {
+		return ErrNotTaken
+	}
+
+	p.Readable = reader
+	return nil
+}
+
+func (p *windowsPty) ReturnWriter(w io.Writer) error {
+	if err := p.state.life.check("return writer"); err != nil {
+		return err
+	}
+	p.takeMu.Lock()
+	defer p.takeMu.Unlock()
+	writer, ok := w.(*windowsWriter)
+	if p.Writable != nil || !ok || writer.write != p.writeHandle || writer.state != p.state {
+		return ErrNotTaken
+	}
+
+	p.Writable = writer
+	return nil
+}
+
+func (p *windowsPty) SpawnCommand(cmd *exec.Cmd, opts ...SpawnOption) (Child, error) {
+	if err := checkCmd(cmd); err != nil {
+		return nil, err
+	}
+
+	var attrOpts []SpawnOption
+	if attr := cmd.SysProcAttr; attr != nil {
+		field := ""
+		switch {
+		case attr.ProcessAttributes != nil:
+			field = "SysProcAttr.ProcessAttributes"
+		case attr.ThreadAttributes != nil:
+			field = "SysProcAttr.ThreadAttributes"
+		case attr.ParentProcess != 0:
+			field = "SysProcAttr.ParentProcess"
+		case attr.HideWindow:
+			// the child has no window of its own, only the pseudoconsole
+			field = "SysProcAttr.HideWindow"
+		case attr.NoInheritHandles && len(attr.AdditionalInheritedHandles) > 0:
+			// on its own it is what happens anyway, nothing is inherited unless asked for
+			field = "SysProcAttr.NoInheritHandles"
+		}
+		if field != "" {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedField, field)
+		}
+
+		if len(attr.AdditionalInheritedHandles) > 0 {
+			handles := make([]windows.Handle, len(attr.AdditionalInheritedHandles))
+			for i, handle := range attr.AdditionalInheritedHandles {
+				handles[i] = windows.Handle(handle)
+			}
+			attrOpts = append(attrOpts, WithInheritedHandles(handles...))
+		}
+		if attr.CreationFlags != 0 {
+			attrOpts = append(attrOpts, withCreationFlags(attr.CreationFlags))
+		}
+		if attr.Token != 0 {
+			attrOpts = append(attrOpts, WithToken(windows.Token(attr.Token)))
+		}
+		if attr.CmdLine != "" {
+			attrOpts = append(attrOpts, WithCommandLine(attr.CmdLine))
+		}
+	}
+
+	// the path is used as argv[0] like CreateProcess does when there is no command line
+	args := []string{cmd.Path}
+	if len(cmd.Args) > 1 {
+		args = append(args, cmd.Args[1:]...)
+	}
+	return p.SpawnArgs(cmd.Path, args, cmd.Env, cmd.Dir, append(attrOpts, opts...)...)
+}
+
+func (p *windowsPty) SpawnArgs(path string, args []string, env []string, dir string, opts ...SpawnOption) (Child, error) {
+	var child *windowsChild
+	if err := p.state.life.spawn(func() (err error) {
+		config := newSpawnConfig(opts)
+		if err := config.checkAffinity(); err != nil {
+			return err
+		}
+		if err := config.prepareDir(dir); err != nil {
+			return err
+		}
+		child, err = p.spawn(path, args, cmdEnv(env), dir, config)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+func (p *windowsPty) spawn(path string, args []string, env []string, dir string, config spawnConfig) (*windowsChild, error) {
 	si := windows.StartupInfoEx{}
 	si.Cb = uint32(unsafe.Sizeof(si))
 	si.Flags = windows.STARTF_USESTDHANDLES
 	si.StdInput = windows.InvalidHandle
 	si.StdOutput = windows.InvalidHandle
 	si.StdErr = windows.InvalidHandle
+	if config.title != "" {
+		title, err := syscall.UTF16PtrFromString(config.title)
+		if err != nil {
+			logger.Println(err)
+			return nil, err
+		}
+		si.Title = title
+	}
+	if config.fill {
+		si.Flags |= startfUseFillAttribute
+		si.FillAttribute = config.fillAttribute
+	}
 
-	attrs, err := windows.NewProcThreadAttributeList(1)
+	attr_count := uint32(1)
+	if len(config.handles) > 0 {
+		attr_count++
+	}
+	attrs, err := windows.NewProcThreadAttributeList(attr_count)
 	if err != nil {
 		logger.Println(err)
 		return nil, err
@@ -170,17 +438,42 @@ func (p *windowsPty) SpawnCommand(cmd *exec.Cmd) (Child, error) {
 		return nil, err
 	}
 
+	// only the listed handles are inherited, not every inheritable handle of the host
+	inherit_handles := len(config.handles) > 0
+	if inherit_handles {
+		handles := make([]windows.Handle, len(config.handles))
+		for i, handle := range config.handles {
+			handles[i] = windows.Handle(handle)
+			if err := windows.SetHandleInformation(
+				handles[i],
+				windows.HANDLE_FLAG_INHERIT,
+				windows.HANDLE_FLAG_INHERIT,
+			); err != nil {
+				logger.Println(err)
+				return nil, err
+			}
+		}
+		if err := attrs.Update(
+			windows.PROC_THREAD_ATTRIBUTE_HANDLE_LIST,
+			unsafe.Pointer(&handles[0]),
+			uintptr(len(handles))*unsafe.Sizeof(handles[0]),
+		); err != nil {
+			logger.Println(err)
+			return nil, err
+		}
+	}
+
 	si.ProcThreadAttributeList = attrs.List()
 
-	exe, err := syscall.UTF16PtrFromString(cmd.Path)
+	exe, err := syscall.UTF16PtrFromString(path)
 	if err != nil {
 		logger.Println(err)
 		return nil, err
 	}
 
-	cmd_str := cmd.Path
-	for _, arg := range cmd.Args[1:] {
-		cmd_str += " " + arg
+	cmd_str := config.commandLine
+	if cmd_str == "" {
+		cmd_str = windows.ComposeCommandLine(args)
 	}
 
 	cmd_line, err := syscall.UTF16PtrFromString(cmd_str)
@@ -189,21 +482,25 @@ func (p *windowsPty) SpawnCommand(cmd *exec.Cmd) (Child, error) {
 		return nil, err
 	}
 
-	env := []uint16{}
-	for _, arg := range cmd.Env {
+	env_utf16 := []uint16{}
+	for _, arg := range env {
 		uint16_arg, err := syscall.UTF16FromString(arg)
 		if err != nil {
 			logger.Println(err)
 			return nil, err
 		}
-		env = append(env, uint16_arg...)
+		env_utf16 = append(env_utf16, uint16_arg...)
 	}
-	env = append(env, 0)
-	env_block := &env[0]
+	if len(env_utf16) == 0 {
+		// an empty block still needs two terminators
+		env_utf16 = append(env_utf16, 0)
+	}
+	env_utf16 = append(env_utf16, 0)
+	env_block := &env_utf16[0]
 
 	var cwd *uint16 = nil
-	if cmd.Dir != "" {
-		cwd, err = syscall.UTF16PtrFromString(cmd.Dir)
+	if dir != "" {
+		cwd, err = syscall.UTF16PtrFromString(dir)
 		if err != nil {
 			logger.Println(err)
 			return nil, err
@@ -212,67 +509,142 @@ func (p *windowsPty) SpawnCommand(cmd *exec.Cmd) (Child, error) {
 
 	pi := windows.ProcessInformation{}
 
-	if err := windows.CreateProcess(
-		exe,
-		cmd_line,
-		nil,
-		nil,
-		false,
-		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
-		env_block,
-		cwd,
-		&si.StartupInfo,
-		&pi,
-	); err != nil {
+	flags := uint32(windows.EXTENDED_STARTUPINFO_PRESENT | windows.CREATE_UNICODE_ENVIRONMENT)
+	flags |= config.creationFlags
+	flags |= config.priority.creationFlags()
+	if config.affinity != 0 {
+		// the affinity has to be set before the child runs
+		flags |= windows.CREATE_SUSPENDED
+	}
+
+	if config.token != 0 {
+		// without this children of services end up on the non-interactive desktop of Session 0
+		si.Desktop, err = syscall.UTF16PtrFromString("winsta0\\default")
+		if err != nil {
+			logger.Println(err)
+			return nil, err
+		}
+		err = windows.CreateProcessAsUser(
+			windows.Token(config.token),
+			exe,
+			cmd_line,
+			nil,
+			nil,
+			inherit_handles,
+			flags,
+			env_block,
+			cwd,
+			&si.StartupInfo,
+			&pi,
+		)
+	} else {
+		err = windows.CreateProcess(
+			exe,
+			cmd_line,
+			nil,
+			nil,
+			inherit_handles,
+			flags,
+			env_block,
+			cwd,
+			&si.StartupInfo,
+			&pi,
+		)
+	}
+	if err != nil {
 		logger.Println(err)
 		return nil, err
 	}
+	if config.affinity != 0 {
+		if err := setProcessAffinityMask(pi.Process, config.affinity); err != nil {
+			logger.Println(err)
+			windows.TerminateProcess(pi.Process, 1)
+			windows.CloseHandle(pi.Thread)
+			windows.CloseHandle(pi.Process)
+			return nil, err
+		}
+		if _, err := windows.ResumeThread(pi.Thread); err != nil {
+			logger.Println(err)
+			windows.TerminateProcess(pi.Process, 1)
+			windows.CloseHandle(pi.Thread)
+			windows.CloseHandle(pi.Process)
+			return nil, err
+		}
+	}
 	err = windows.CloseHandle(pi.Thread)
 	if err != nil {
 		logger.Println(err)
 		return nil, err
 	}
 
-	return &windowsChild{
-		pi.Process,
-	}, nil
+	child := &windowsChild{
+		Proc: pi.Process,
+		life: &p.state.life,
+		done: make(chan struct{}),
+	}
+	// safety net for children that are never released
+	runtime.SetFinalizer(child, (*windowsChild).Release)
+	return child, nil
+}
+
+func (p *windowsPty) Done() <-chan struct{} {
+	return p.state.life.closing()
 }
 
 func (p *windowsPty) Close() error {
-	if p.closed {
-		return ErrAlreadyClosed
+	if err := p.state.life.close(); err != nil {
+		return err
 	}
+	size, _ := p.GetSize()
 	go func() {
 		// https://learn.microsoft.com/en-us/windows/console/closepseudoconsole#remarks
-		reader := &windowsReader{p.readHandle}
+		// respond to cursor position requests otherwise the process will hang don't know why
+		reader := NewResponder(
+			p,
+			&windowsReader{read: p.readHandle},
+			&windowsWriter{write: p.writeHandle},
+			drainResponderOptions(size),
+		)
 		buffer := make([]byte, 4096)
 		for {
-			n, err := reader.Read(buffer)
-			if err != nil {
-				if err == io.EOF {
-					break
+			if _, err := reader.Read(buffer); err != nil {
+				if err != io.EOF {
+					logger.Println(err)
+					reportBackground(p, "close", err)
 				}
-				logger.Println(err)
-				return
-			}
-			// respond to cursor position requests otherwise the process will hang don't know why
-			if n == 4 && string(buffer[:n]) == "\x1b[6n" {
-				writer := &windowsWriter{p.writeHandle}
-				writer.Write([]byte("\x1b[24;80R"))
+				break
 			}
 		}
+
+		// wait for reads and writes that were in flight during Close
+		p.state.mu.Lock()
+		defer p.state.mu.Unlock()
+		if err := closeHandle(p.readHandle); err != nil {
+			logger.Println(err)
+			reportBackground(p, "close", err)
+		}
+		if err := closeHandle(p.writeHandle); err != nil {
+			logger.Println(err)
+			reportBackground(p, "close", err)
+		}
 	}()
 	windows.ClosePseudoConsole(p.PCon)
-	if err := windows.CloseHandle(p.readHandle); err != nil {
-		logger.Println(err)
-		return err
+	return nil
+}
+
+// Answers for the output drained during Close.
+// Nobody sees the screen anymore, the cursor is reported in the bottom right cell
+// of the last size, a position that exists whatever the size, instead of a fixed
+// 24;80 that is off screen for smaller ptys.
+func drainResponderOptions(size PtySize) ResponderOptions {
+	if size.Rows == 0 || size.Cols == 0 {
+		size = DefaultPtySize()
 	}
-	if err := windows.CloseHandle(p.writeHandle); err != nil {
-		logger.Println(err)
-		return err
+	return ResponderOptions{
+		CursorPosition: func() (int, int, bool) {
+			return int(size.Rows), int(size.Cols), true
+		},
 	}
-	p.closed = true
-	return nil
 }
 
 type Pipe struct {
@@ -342,13 +714,15 @@ func NewPty(size PtySize) (Pty, error) {
 	windows.CloseHandle(stdin.Read)
 	windows.CloseHandle(stdout.Write)
 
+	state := &pipeState{}
+
 	return &windowsPty{
-		PCon,
-		size,
-		&windowsReader{stdout.Read},
-		stdout.Read,
-		&windowsWriter{stdin.Write},
-		stdin.Write,
-		false,
+		PCon:        PCon,
+		PtySize:     size,
+		Readable:    &windowsReader{stdout.Read, state},
+		readHandle:  stdout.Read,
+		Writable:    &windowsWriter{stdin.Write, state},
+		writeHandle: stdin.Write,
+		state:       state,
 	}, nil
 }
@@ -0,0 +1,145 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Close while a read and a write are blocked: the read ends with io.EOF, the write
+// with ErrPtyClosed, later calls see ErrPtyClosed too and the handles are only closed
+// once nothing uses them anymore.
+func TestCloseWhileReadAndWrite(t *testing.T) {
+	created, err := NewPty(DefaultPtySize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := created.(*windowsPty)
+
+	// Swap the pipes of the console for ones the test controls, so the reader and
+	// writer block until the test plays the console exiting.
+	windows.CloseHandle(p.readHandle)
+	windows.CloseHandle(p.writeHandle)
+	output, err := createPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := createPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.readHandle = output.Read
+	p.Readable = &windowsReader{output.Read, p.state}
+	p.writeHandle = input.Write
+	p.Writable = &windowsWriter{input.Write, p.state}
+
+	var readDone, writeDone atomic.Bool
+	var closedEarly atomic.Bool
+	var closes sync.WaitGroup
+	closes.Add(2)
+	defer func(original func(windows.Handle) error) { closeHandle = original }(closeHandle)
+	closeHandle = func(handle windows.Handle) error {
+		defer closes.Done()
+		if !readDone.Load() || !writeDone.Load() {
+			closedEarly.Store(true)
+		}
+		return windows.CloseHandle(handle)
+	}
+
+	r, err := p.TakeReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := p.TakeWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		readDone.Store(true)
+		readErr <- err
+	}()
+	writeErr := make(chan error, 1)
+	go func() {
+		// larger than the pipe buffer, nobody reads the other end
+		_, err := w.Write(make([]byte, 1<<20))
+		writeDone.Store(true)
+		writeErr <- err
+	}()
+	// let both block
+	time.Sleep(100 * time.Millisecond)
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the console exits: its end of the output goes away first
+	windows.CloseHandle(output.Write)
+	if err := <-readErr; err != io.EOF {
+		t.Errorf("in-flight Read: got %v, want io.EOF", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if closedEarly.Load() {
+		t.Fatal("handles closed while a Write was in flight")
+	}
+
+	windows.CloseHandle(input.Read)
+	// the pipe broke because of Close, not because the child exited
+	if err := <-writeErr; !errors.Is(err, ErrPtyClosed) {
+		t.Errorf("in-flight Write: got %v, want ErrPtyClosed", err)
+	}
+
+	closes.Wait()
+	if closedEarly.Load() {
+		t.Error("handles closed while a Read or Write was in flight")
+	}
+
+	if _, err := r.Read(make([]byte, 16)); !errors.Is(err, ErrPtyClosed) {
+		t.Errorf("Read after Close: got %v, want ErrPtyClosed", err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrPtyClosed) {
+		t.Errorf("Write after Close: got %v, want ErrPtyClosed", err)
+	}
+}
+
+// A pipe breaking while the pty is open means nobody reads the input anymore.
+func TestWriteBrokenPipe(t *testing.T) {
+	input, err := createPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer windows.CloseHandle(input.Write)
+	windows.CloseHandle(input.Read)
+
+	w := &windowsWriter{input.Write, &pipeState{}}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrChildExited) {
+		t.Errorf("got %v, want ErrChildExited", err)
+	}
+}
+
+func TestDrainResponderOptions(t *testing.T) {
+	for _, tc := range []struct {
+		size     PtySize
+		row, col int
+	}{
+		{PtySize{Rows: 10, Cols: 40}, 10, 40},
+		{PtySize{Rows: 50, Cols: 200}, 50, 200},
+		// unknown sizes fall back to the default
+		{PtySize{}, 24, 80},
+	} {
+		row, col, ok := drainResponderOptions(tc.size).CursorPosition()
+		if !ok || row != tc.row || col != tc.col {
+			t.Errorf("%+v: got %d;%d %t, want %d;%d", tc.size, row, col, ok, tc.row, tc.col)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package ptytest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// The pauses of Send only pass when the fake clock is advanced.
+func TestFakeClockDrivesSend(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- pty.Send(&out, strings.NewReader("abc"), pty.SendOptions{
+			ChunkSize: 1,
+			Delay:     time.Hour,
+			Clock:     clock,
+		})
+	}()
+
+	for i, want := range []string{"a", "ab"} {
+		clock.BlockUntil(1)
+		if got := out.String(); got != want {
+			t.Fatalf("before advance %d: got %q, want %q", i, got, want)
+		}
+		clock.Advance(time.Hour)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "abc" {
+		t.Errorf("got %q, want %q", got, "abc")
+	}
+}
+
+// WaitFor times out on the fake clock, not the real one.
+func TestFakeClockDrivesWaitFor(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := NewVirtualPty(pty.DefaultPtySize(), Script{})
+	defer p.Close()
+	r, _ := p.TakeReader()
+	out := NewOutput(r)
+	out.Clock = clock
+
+	go func() {
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}()
+	if _, err := out.WaitForString("never", time.Hour); err != ErrTimeout {
+		t.Errorf("got %v, want ErrTimeout", err)
+	}
+}
+
+// Coalesced output is delivered once CoalesceSize is reached or CoalesceDelay
+// passed on the fake clock after the first byte.
+func TestFakeClockDrivesStreamCoalescing(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	r, w := io.Pipe()
+	opts := pty.DefaultStreamOptions()
+	opts.Latency = pty.LatencyThroughput
+	opts.CoalesceSize = 8
+	opts.CoalesceDelay = time.Hour
+	opts.Clock = clock
+	s := pty.NewStream(r, opts)
+
+	next := func(want string) {
+		t.Helper()
+		select {
+		case chunk, ok := <-s.Output():
+			if !ok || string(chunk) != want {
+				t.Fatalf("got %q, %t, want %q", chunk, ok, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("nothing delivered, want %q", want)
+		}
+	}
+	nothing := func() {
+		t.Helper()
+		select {
+		case chunk := <-s.Output():
+			t.Fatalf("got %q before the deadline", chunk)
+		default:
+		}
+	}
+
+	w.Write([]byte("abc"))
+	clock.BlockUntil(1)
+	nothing()
+	clock.Advance(time.Hour)
+	next("abc")
+
+	// a full chunk goes out right away, the rest waits for its own deadline
+	w.Write([]byte("0123456789"))
+	next("01234567")
+	clock.BlockUntil(2)
+	nothing()
+	clock.Advance(time.Hour)
+	next("89")
+
+	// the end of the output doesn't wait for the deadline
+	w.Write([]byte("zz"))
+	clock.BlockUntil(1)
+	w.Close()
+	next("zz")
+	if _, ok := <-s.Output(); ok {
+		t.Error("Output not closed at the end")
+	}
+}
@@ -0,0 +1,207 @@
+package ptytest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Returned when a dialogue takes a Branch with Fail set, check with errors.Is.
+var ErrDialogueFailed = errors.New("dialogue failed")
+
+// Timeout of the steps of a Dialogue that don't set any.
+const DefaultDialogueTimeout = 10 * time.Second
+
+// Dialogue is an expect/send conversation with a pty, written as a struct or
+// loaded from JSON with LoadDialogue.
+//
+//	{"timeout": "5s", "steps": [
+//		{"expect": [{"match": "login: ", "send": "root\r"}]},
+//		{"expect": [
+//			{"match": "[$#] $", "end": true},
+//			{"match": "incorrect", "fail": "wrong password"}
+//		]}
+//	]}
+type Dialogue struct {
+	// Timeout of every step that doesn't set its own.
+	Timeout Duration       `json:"timeout"`
+	Steps   []DialogueStep `json:"steps"`
+}
+
+// A step sends Send, then waits for the output to match one of its branches and
+// takes the one that matches first. Steps run in order unless a branch jumps.
+type DialogueStep struct {
+	// Name branches and OnTimeout jump to.
+	Label string `json:"label"`
+
+	// Written to the pty when the step starts.
+	Send string `json:"send"`
+
+	// Nothing is waited for without branches.
+	Expect []Branch `json:"expect"`
+
+	// How long to wait for a branch to match.
+	Timeout Duration `json:"timeout"`
+
+	// Label to continue with when no branch matched in time, empty fails the
+	// dialogue with ErrTimeout.
+	OnTimeout string `json:"onTimeout"`
+}
+
+type Branch struct {
+	// Regular expression in Go syntax matched against the output not consumed yet.
+	// Everything up to the end of the match is consumed.
+	Match string `json:"match"`
+
+	// Written to the pty when the branch is taken.
+	Send string `json:"send"`
+
+	// Label of the step to continue with, empty is the next step.
+	Goto string `json:"goto"`
+
+	// End the dialogue successfully.
+	End bool `json:"end"`
+
+	// End the dialogue with ErrDialogueFailed and this reason.
+	Fail string `json:"fail"`
+}
+
+// time.Duration that reads "1.5s" style strings or nanoseconds from JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+		*d = Duration(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Read a Dialogue from JSON and check it, unknown fields are an error.
+func LoadDialogue(r io.Reader) (*Dialogue, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var d Dialogue
+	if err := decoder.Decode(&d); err != nil {
+		return nil, err
+	}
+	if _, _, err := d.compile(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Compiled patterns of every step and the index of every label.
+func (d *Dialogue) compile() ([][]*regexp.Regexp, map[string]int, error) {
+	labels := map[string]int{}
+	for i, step := range d.Steps {
+		if step.Label == "" {
+			continue
+		}
+		if _, ok := labels[step.Label]; ok {
+			return nil, nil, fmt.Errorf("step %d: duplicate label %q", i, step.Label)
+		}
+		labels[step.Label] = i
+	}
+
+	patterns := make([][]*regexp.Regexp, len(d.Steps))
+	for i, step := range d.Steps {
+		if _, ok := labels[step.OnTimeout]; step.OnTimeout != "" && !ok {
+			return nil, nil, fmt.Errorf("step %d: unknown label %q", i, step.OnTimeout)
+		}
+		for _, branch := range step.Expect {
+			pattern, err := regexp.Compile(branch.Match)
+			if err != nil {
+				return nil, nil, fmt.Errorf("step %d: %w", i, err)
+			}
+			if _, ok := labels[branch.Goto]; branch.Goto != "" && !ok {
+				return nil, nil, fmt.Errorf("step %d: unknown label %q", i, branch.Goto)
+			}
+			patterns[i] = append(patterns[i], pattern)
+		}
+	}
+	return patterns, labels, nil
+}
+
+// Run the dialogue against the output of a pty collected in out and its writer w.
+// Timeouts are measured with out.Clock.
+func (d *Dialogue) Run(out *Output, w io.Writer) error {
+	patterns, labels, err := d.compile()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(d.Steps); {
+		step := d.Steps[i]
+		if step.Send != "" {
+			if _, err := io.WriteString(w, step.Send); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		}
+		if len(step.Expect) == 0 {
+			i++
+			continue
+		}
+
+		timeout := time.Duration(step.Timeout)
+		if timeout == 0 {
+			timeout = time.Duration(d.Timeout)
+		}
+		if timeout == 0 {
+			timeout = DefaultDialogueTimeout
+		}
+		taken := -1
+		_, err := out.WaitFor(func(pending []byte) int {
+			// the earliest match wins, the first branch among equal ones
+			start, end := -1, -1
+			for j, pattern := range patterns[i] {
+				if match := pattern.FindIndex(pending); match != nil && (start < 0 || match[0] < start) {
+					taken, start, end = j, match[0], match[1]
+				}
+			}
+			return end
+		}, timeout)
+		if errors.Is(err, ErrTimeout) && step.OnTimeout != "" {
+			i = labels[step.OnTimeout]
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+
+		branch := step.Expect[taken]
+		if branch.Send != "" {
+			if _, err := io.WriteString(w, branch.Send); err != nil {
+				return fmt.Errorf("step %d: %w", i, err)
+			}
+		}
+		switch {
+		case branch.Fail != "":
+			return fmt.Errorf("%w: %s", ErrDialogueFailed, branch.Fail)
+		case branch.End:
+			return nil
+		case branch.Goto != "":
+			i = labels[branch.Goto]
+		default:
+			i++
+		}
+	}
+	return nil
+}
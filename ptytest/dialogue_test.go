@@ -0,0 +1,134 @@
+package ptytest
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+const loginDialogue = `{"timeout": "5s", "steps": [
+	{"expect": [{"match": "login: ", "send": "root\r"}]},
+	{"label": "password", "expect": [{"match": "[Pp]assword: ", "send": "secret\r"}]},
+	{"expect": [
+		{"match": "\\$ $", "end": true},
+		{"match": "try again\r\n", "goto": "password"},
+		{"match": "locked", "fail": "account locked"}
+	]}
+]}`
+
+func runDialogue(t *testing.T, d *Dialogue, script Script) error {
+	t.Helper()
+	p := NewVirtualPty(pty.DefaultPtySize(), script)
+	defer p.Close()
+	r, _ := p.TakeReader()
+	w, _ := p.TakeWriter()
+	if _, err := p.SpawnCommand(exec.Command("login")); err != nil {
+		t.Fatal(err)
+	}
+	return d.Run(NewOutput(r), w)
+}
+
+func TestDialogue(t *testing.T) {
+	d, err := LoadDialogue(strings.NewReader(loginDialogue))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Timeout != Duration(5*time.Second) || len(d.Steps) != 3 || len(d.Steps[2].Expect) != 3 {
+		t.Fatalf("loaded %+v", d)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		steps []Step
+		err   error
+	}{
+		{"success", []Step{
+			{Output: "login: "},
+			{Expect: "root\r", Output: "Password: "},
+			{Expect: "secret\r", Output: "\r\n$ "},
+		}, nil},
+		// the retry jumps back to the password step
+		{"retry", []Step{
+			{Output: "login: "},
+			{Expect: "root\r", Output: "Password: "},
+			{Expect: "secret\r", Output: "try again\r\npassword: "},
+			{Expect: "secret\r", Output: "\r\n$ "},
+		}, nil},
+		{"fail", []Step{
+			{Output: "login: "},
+			{Expect: "root\r", Output: "Password: "},
+			{Expect: "secret\r", Output: "account locked"},
+		}, ErrDialogueFailed},
+	} {
+		if err := runDialogue(t, d, Script{Steps: tc.steps}); !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+// The earliest match wins, whichever branch it belongs to.
+func TestDialogueEarliestMatch(t *testing.T) {
+	d := &Dialogue{Steps: []DialogueStep{{Expect: []Branch{
+		{Match: "second", Fail: "took the later match"},
+		{Match: "first", End: true},
+	}}}}
+	if err := runDialogue(t, d, Script{Steps: []Step{{Output: "first second"}}}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialogueTimeout(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	d := &Dialogue{Steps: []DialogueStep{
+		{Expect: []Branch{{Match: "never"}}, Timeout: Duration(time.Minute), OnTimeout: "wake"},
+		{Expect: []Branch{{Match: "never"}}},
+		{Label: "wake", Send: "\r", Expect: []Branch{{Match: "awake", End: true}}},
+	}}
+	p := NewVirtualPty(pty.DefaultPtySize(), Script{Steps: []Step{{Expect: "\r", Output: "awake"}}})
+	defer p.Close()
+	r, _ := p.TakeReader()
+	w, _ := p.TakeWriter()
+	p.SpawnCommand(exec.Command("sh"))
+	out := NewOutput(r)
+	out.Clock = clock
+
+	done := make(chan error, 1)
+	go func() { done <- d.Run(out, w) }()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// without OnTimeout the dialogue fails, the timer of the last step is still pending
+	d = &Dialogue{Timeout: Duration(time.Minute), Steps: []DialogueStep{{Expect: []Branch{{Match: "never"}}}}}
+	go func() { done <- d.Run(out, w) }()
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	if err := <-done; !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want ErrTimeout", err)
+	}
+}
+
+func TestLoadDialogueErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"steps": [{"expect": [{"match": "("}]}]}`,
+		`{"steps": [{"expect": [{"match": "x", "goto": "missing"}]}]}`,
+		`{"steps": [{"onTimeout": "missing"}]}`,
+		`{"steps": [{"label": "a"}, {"label": "a"}]}`,
+		`{"steps": [{"unknown": true}]}`,
+		`{"timeout": "soon"}`,
+	} {
+		if _, err := LoadDialogue(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: loaded", in)
+		}
+	}
+	d, err := LoadDialogue(strings.NewReader(`{"timeout": 1000}`))
+	if err != nil || d.Timeout != Duration(time.Microsecond) {
+		t.Errorf("got %+v, %v", d, err)
+	}
+}
@@ -0,0 +1,156 @@
+package ptytest
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+var ErrInjected = errors.New("injected fault")
+
+// Faults to inject into a Pty. The zero value injects nothing.
+type Faults struct {
+	// Limit every read to at most this many bytes.
+	ShortReads int
+
+	// Sleep this long before every write.
+	WriteDelay time.Duration
+
+	// Break the reader after this many bytes were read and
+	// the writer after this many bytes were written.
+	// Both then fail with io.ErrClosedPipe.
+	BreakAfter int
+
+	// Fail every nth Resize with ErrInjected.
+	ResizeFailEvery int
+
+	// Clock WriteDelay is measured with, nil is the system clock.
+	Clock pty.Clock
+}
+
+type faultyPty struct {
+	pty.Pty
+	faults  Faults
+	mu      sync.Mutex
+	resizes int
+	// kept here so giving back and taking again doesn't reset BreakAfter
+	read    int
+	written int
+}
+
+// Wrap p so higher layers can be verified against short reads, slow writes,
+// pipes breaking mid-stream and failing resizes.
+func NewFaultyPty(p pty.Pty, faults Faults) pty.Pty {
+	return &faultyPty{Pty: p, faults: faults}
+}
+
+func (p *faultyPty) Resize(size pty.PtySize) error {
+	if every := p.faults.ResizeFailEvery; every > 0 {
+		p.mu.Lock()
+		p.resizes++
+		fail := p.resizes%every == 0
+		p.mu.Unlock()
+		if fail {
+			return ErrInjected
+		}
+	}
+	return p.Pty.Resize(size)
+}
+
+func (p *faultyPty) TakeReader() (io.Reader, error) {
+	r, err := p.Pty.TakeReader()
+	if err != nil {
+		return nil, err
+	}
+	return &faultyReader{r: r, p: p}, nil
+}
+
+func (p *faultyPty) TakeWriter() (io.Writer, error) {
+	w, err := p.Pty.TakeWriter()
+	if err != nil {
+		return nil, err
+	}
+	return &faultyWriter{w: w, p: p}, nil
+}
+
+func (p *faultyPty) ReturnReader(r io.Reader) error {
+	if reader, ok := r.(*faultyReader); ok {
+		r = reader.r
+	}
+	return p.Pty.ReturnReader(r)
+}
+
+func (p *faultyPty) ReturnWriter(w io.Writer) error {
+	if writer, ok := w.(*faultyWriter); ok {
+		w = writer.w
+	}
+	return p.Pty.ReturnWriter(w)
+}
+
+type faultyReader struct {
+	r io.Reader
+	p *faultyPty
+}
+
+func (r *faultyReader) Read(b []byte) (int, error) {
+	faults := r.p.faults
+	if limit := faults.BreakAfter; limit > 0 {
+		r.p.mu.Lock()
+		read := r.p.read
+		r.p.mu.Unlock()
+		if read >= limit {
+			return 0, io.ErrClosedPipe
+		}
+		if len(b) > limit-read {
+			b = b[:limit-read]
+		}
+	}
+	if limit := faults.ShortReads; limit > 0 && len(b) > limit {
+		b = b[:limit]
+	}
+	n, err := r.r.Read(b)
+	r.p.mu.Lock()
+	r.p.read += n
+	r.p.mu.Unlock()
+	return n, err
+}
+
+type faultyWriter struct {
+	w io.Writer
+	p *faultyPty
+}
+
+func (w *faultyWriter) Write(b []byte) (int, error) {
+	faults := w.p.faults
+	if faults.WriteDelay > 0 {
+		clock := faults.Clock
+		if clock == nil {
+			clock = pty.SystemClock()
+		}
+		<-clock.After(faults.WriteDelay)
+	}
+	broken := false
+	if limit := faults.BreakAfter; limit > 0 {
+		w.p.mu.Lock()
+		written := w.p.written
+		w.p.mu.Unlock()
+		if written >= limit {
+			return 0, io.ErrClosedPipe
+		}
+		if len(b) > limit-written {
+			b = b[:limit-written]
+			broken = true
+		}
+	}
+	n, err := w.w.Write(b)
+	w.p.mu.Lock()
+	w.p.written += n
+	w.p.mu.Unlock()
+	if err == nil && broken {
+		err = io.ErrClosedPipe
+	}
+	return n, err
+}
@@ -0,0 +1,117 @@
+package ptytest
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+func faultyFor(t *testing.T, script Script, faults Faults) pty.Pty {
+	t.Helper()
+	p := NewFaultyPty(NewVirtualPty(pty.DefaultPtySize(), script), faults)
+	t.Cleanup(func() { p.Close() })
+	if _, err := p.SpawnCommand(exec.Command("sh")); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestFaultsShortReads(t *testing.T) {
+	p := faultyFor(t, Script{Steps: []Step{{Output: "abcdefgh"}}}, Faults{ShortReads: 3})
+	r, _ := p.TakeReader()
+	var got []byte
+	for len(got) < 8 {
+		buffer := make([]byte, 16)
+		n, err := r.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 3 {
+			t.Fatalf("read %d bytes, want at most 3", n)
+		}
+		got = append(got, buffer[:n]...)
+	}
+	if string(got) != "abcdefgh" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// The limit holds across giving the reader and writer back and taking them again.
+func TestFaultsBreakAfter(t *testing.T) {
+	p := faultyFor(t, Script{Steps: []Step{{Output: "abcdefgh"}}}, Faults{BreakAfter: 5})
+
+	r, _ := p.TakeReader()
+	out, err := io.ReadAll(r)
+	if string(out) != "abcde" || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Read: got %q, %v, want abcde, io.ErrClosedPipe", out, err)
+	}
+	if err := p.ReturnReader(r); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = p.TakeReader()
+	if n, err := r.Read(make([]byte, 16)); n != 0 || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Read after taking again: got %d, %v", n, err)
+	}
+
+	w, _ := p.TakeWriter()
+	if n, err := w.Write([]byte("123")); n != 3 || err != nil {
+		t.Errorf("Write: got %d, %v", n, err)
+	}
+	if n, err := w.Write([]byte("4567")); n != 2 || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("breaking Write: got %d, %v, want 2, io.ErrClosedPipe", n, err)
+	}
+	if err := p.ReturnWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	w, _ = p.TakeWriter()
+	if n, err := w.Write([]byte("8")); n != 0 || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Write after taking again: got %d, %v", n, err)
+	}
+}
+
+func TestFaultsResizeFailEvery(t *testing.T) {
+	p := faultyFor(t, Script{}, Faults{ResizeFailEvery: 2})
+	for i, fail := range []bool{false, true, false, true} {
+		size := pty.PtySize{Rows: uint16(10 + i), Cols: 80}
+		err := p.Resize(size)
+		if errors.Is(err, ErrInjected) != fail {
+			t.Errorf("resize %d: got %v", i+1, err)
+		}
+		// failed resizes don't reach the pty
+		got, _ := p.GetSize()
+		if want := (pty.PtySize{Rows: 10 + uint16(i&^1), Cols: 80}); got != want {
+			t.Errorf("resize %d: size %+v, want %+v", i+1, got, want)
+		}
+	}
+}
+
+func TestFaultsWriteDelay(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := faultyFor(t, Script{Steps: []Step{{Expect: "x", Output: "got it"}}}, Faults{WriteDelay: time.Second, Clock: clock})
+	r, _ := p.TakeReader()
+	w, _ := p.TakeWriter()
+	out := NewOutput(r)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Write([]byte("x"))
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("written before the delay passed")
+	default:
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := out.WaitForString("got it", 5*time.Second); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,287 @@
+package ptytest
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+// A single step of a Script.
+type Step struct {
+	// Wait until this has been written to the pty before continuing.
+	// Empty means don't wait.
+	Expect string
+
+	// Time to wait before Output is emitted.
+	Delay time.Duration
+
+	// Bytes the virtual child prints.
+	Output string
+}
+
+// Script drives a virtual child in place of a real process.
+type Script struct {
+	Steps []Step
+
+	// Exit code reported once all steps ran.
+	ExitCode uint32
+
+	// Clock the delays of the steps are measured with, nil is the system clock.
+	Clock pty.Clock
+}
+
+type virtualPty struct {
+	mu      sync.Mutex
+	size    pty.PtySize
+	script  Script
+	outRead *io.PipeReader
+	out     *io.PipeWriter
+	reader  io.Reader
+	writer  io.Writer
+	input   []byte
+	written chan struct{}
+	done    chan struct{}
+	closing chan struct{}
+	child   *virtualChild
+	closed  bool
+}
+
+// Create a Pty that runs script instead of spawning a process, so tests of
+// code built on top of Pty are deterministic and don't depend on the platform.
+// The command and options passed to SpawnCommand and SpawnArgs are ignored.
+// Closing it kills a running child with exit code 1, like ConPTY does.
+func NewVirtualPty(size pty.PtySize, script Script) pty.Pty {
+	outRead, out := io.Pipe()
+	p := &virtualPty{
+		size:    size,
+		script:  script,
+		outRead: outRead,
+		out:     out,
+		written: make(chan struct{}),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	p.reader = outRead
+	p.writer = &virtualWriter{p}
+	return p
+}
+
+func (p *virtualPty) ReturnReader(r io.Reader) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return pty.ErrAlreadyClosed
+	}
+	if p.reader != nil || r != io.Reader(p.outRead) {
+		return pty.ErrNotTaken
+	}
+
+	p.reader = r
+	return nil
+}
+
+func (p *virtualPty) ReturnWriter(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return pty.ErrAlreadyClosed
+	}
+	if writer, ok := w.(*virtualWriter); p.writer != nil || !ok || writer.p != p {
+		return pty.ErrNotTaken
+	}
+
+	p.writer = w
+	return nil
+}
+
+func (p *virtualPty) Resize(size pty.PtySize) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return pty.ErrAlreadyClosed
+	}
+	p.size = size
+	return nil
+}
+
+func (p *virtualPty) GetSize() (pty.PtySize, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size, nil
+}
+
+func (p *virtualPty) TakeReader() (io.Reader, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, pty.ErrAlreadyClosed
+	}
+	if p.reader == nil {
+		return nil, pty.ErrAlreadyTaken
+	}
+
+	temp := p.reader
+	p.reader = nil
+	return temp, nil
+}
+
+func (p *virtualPty) TakeWriter() (io.Writer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, pty.ErrAlreadyClosed
+	}
+	if p.writer == nil {
+		return nil, pty.ErrAlreadyTaken
+	}
+
+	temp := p.writer
+	p.writer = nil
+	return temp, nil
+}
+
+func (p *virtualPty) SpawnCommand(cmd *exec.Cmd, opts ...pty.SpawnOption) (pty.Child, error) {
+	return p.SpawnArgs(cmd.Path, cmd.Args, cmd.Env, cmd.Dir, opts...)
+}
+
+func (p *virtualPty) SpawnArgs(path string, args []string, env []string, dir string, opts ...pty.SpawnOption) (pty.Child, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, pty.ErrAlreadyClosed
+	}
+	if p.child != nil {
+		return nil, pty.ErrAlreadySpawned
+	}
+
+	child := &virtualChild{done: p.done}
+	p.child = child
+	go p.run(child)
+	return child, nil
+}
+
+func (p *virtualPty) run(child *virtualChild) {
+	clock := p.script.Clock
+	if clock == nil {
+		clock = pty.SystemClock()
+	}
+	// the pty closing kills the child like ConPTY does, the script's exit code
+	// wins if it got to the end
+	defer child.exit(1)
+	for _, step := range p.script.Steps {
+		if step.Expect != "" && !p.expect(step.Expect) {
+			return
+		}
+		if step.Delay > 0 {
+			select {
+			case <-clock.After(step.Delay):
+			case <-p.done:
+				return
+			case <-p.closing:
+				return
+			}
+		}
+		if _, err := p.out.Write([]byte(step.Output)); err != nil {
+			return
+		}
+	}
+	child.exit(p.script.ExitCode)
+}
+
+// Block until s has been written and consume the input up to it.
+// Returns false if the child was killed or the pty closed while waiting.
+func (p *virtualPty) expect(s string) bool {
+	for {
+		p.mu.Lock()
+		if i := bytes.Index(p.input, []byte(s)); i >= 0 {
+			p.input = p.input[i+len(s):]
+			p.mu.Unlock()
+			return true
+		}
+		written := p.written
+		p.mu.Unlock()
+
+		select {
+		case <-written:
+		case <-p.done:
+			return false
+		case <-p.closing:
+			return false
+		}
+	}
+}
+
+func (p *virtualPty) Done() <-chan struct{} {
+	return p.closing
+}
+
+func (p *virtualPty) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return pty.ErrAlreadyClosed
+	}
+	p.closed = true
+	close(p.closing)
+	p.out.CloseWithError(pty.ErrPtyClosed)
+	if p.child != nil {
+		p.child.exit(1)
+	}
+	return nil
+}
+
+type virtualWriter struct {
+	p *virtualPty
+}
+
+func (w *virtualWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	if w.p.closed {
+		return 0, pty.ErrPtyClosed
+	}
+	w.p.input = append(w.p.input, b...)
+	close(w.p.written)
+	w.p.written = make(chan struct{})
+	return len(b), nil
+}
+
+type virtualChild struct {
+	once sync.Once
+	done chan struct{}
+	code uint32
+}
+
+func (c *virtualChild) exit(code uint32) {
+	c.once.Do(func() {
+		c.code = code
+		close(c.done)
+	})
+}
+
+func (c *virtualChild) Exited() (uint32, error) {
+	select {
+	case <-c.done:
+		return c.code, nil
+	default:
+		return 0, pty.ErrNotFinished
+	}
+}
+
+func (c *virtualChild) Wait() (uint32, error) {
+	<-c.done
+	return c.code, nil
+}
+
+func (c *virtualChild) Kill() error {
+	c.exit(1)
+	return nil
+}
+
+func (c *virtualChild) Release() error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package ptytest
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+func TestVirtualScript(t *testing.T) {
+	p := NewVirtualPty(pty.DefaultPtySize(), Script{
+		Steps: []Step{
+			{Output: "login: "},
+			{Expect: "root\r", Output: "welcome\r\n"},
+		},
+		ExitCode: 3,
+	})
+	defer p.Close()
+	r, _ := p.TakeReader()
+	w, _ := p.TakeWriter()
+	out := NewOutput(r)
+
+	child, err := p.SpawnCommand(exec.Command("login"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := out.WaitForString("login: ", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("root\r"))
+	if _, err := out.WaitForString("welcome\r\n", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := child.Wait(); err != nil || code != 3 {
+		t.Errorf("Wait: got %d, %v, want 3", code, err)
+	}
+	if _, err := p.SpawnCommand(exec.Command("login")); !errors.Is(err, pty.ErrAlreadySpawned) {
+		t.Errorf("second spawn: got %v, want ErrAlreadySpawned", err)
+	}
+}
+
+func TestVirtualClose(t *testing.T) {
+	// the child waits for input that never comes
+	p := NewVirtualPty(pty.DefaultPtySize(), Script{
+		Steps: []Step{{Expect: "never"}},
+	})
+	r, _ := p.TakeReader()
+	w, _ := p.TakeWriter()
+	child, err := p.SpawnCommand(exec.Command("sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		read <- err
+	}()
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	waited := make(chan uint32, 1)
+	go func() {
+		code, _ := child.Wait()
+		waited <- code
+	}()
+	select {
+	case code := <-waited:
+		if code != 1 {
+			t.Errorf("exit code after Close: got %d, want 1", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked after Close")
+	}
+
+	if err := <-read; !errors.Is(err, pty.ErrPtyClosed) {
+		t.Errorf("in-flight Read: got %v, want ErrPtyClosed", err)
+	}
+	if _, err := r.Read(make([]byte, 16)); !errors.Is(err, pty.ErrPtyClosed) {
+		t.Errorf("Read after Close: got %v, want ErrPtyClosed", err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, pty.ErrPtyClosed) {
+		t.Errorf("Write after Close: got %v, want ErrPtyClosed", err)
+	}
+	if err := p.ReturnReader(r); !errors.Is(err, pty.ErrAlreadyClosed) {
+		t.Errorf("ReturnReader after Close: got %v, want ErrAlreadyClosed", err)
+	}
+	if _, err := p.TakeWriter(); !errors.Is(err, pty.ErrAlreadyClosed) {
+		t.Errorf("TakeWriter after Close: got %v, want ErrAlreadyClosed", err)
+	}
+	if err := p.Close(); !errors.Is(err, pty.ErrAlreadyClosed) {
+		t.Errorf("second Close: got %v, want ErrAlreadyClosed", err)
+	}
+}
@@ -0,0 +1,111 @@
+package ptytest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/UfukUstali/go-pty"
+)
+
+var ErrTimeout = errors.New("timed out")
+
+// Output collects everything read from a pty so tests can wait on it
+// instead of sleeping.
+type Output struct {
+	// Clock timeouts are measured with, nil is the system clock.
+	// Set it before waiting.
+	Clock pty.Clock
+
+	mu      sync.Mutex
+	buf     []byte
+	off     int
+	err     error
+	updated chan struct{}
+}
+
+// Start reading from r in its own goroutine until it returns an error.
+func NewOutput(r io.Reader) *Output {
+	o := &Output{updated: make(chan struct{})}
+	go o.pump(r)
+	return o
+}
+
+func (o *Output) pump(r io.Reader) {
+	buffer := make([]byte, 4096)
+	for {
+		n, err := r.Read(buffer)
+		o.mu.Lock()
+		o.buf = append(o.buf, buffer[:n]...)
+		if err != nil {
+			o.err = err
+		}
+		close(o.updated)
+		o.updated = make(chan struct{})
+		o.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Block until cond reports true for the output that has not been consumed yet.
+// cond returns how many bytes to consume, or -1 to keep waiting.
+// The consumed output is returned.
+func (o *Output) WaitFor(cond func(pending []byte) int, timeout time.Duration) (string, error) {
+	clock := o.Clock
+	if clock == nil {
+		clock = pty.SystemClock()
+	}
+	expired := clock.After(timeout)
+	for {
+		o.mu.Lock()
+		pending := o.buf[o.off:]
+		if n := cond(pending); n >= 0 {
+			o.off += n
+			o.mu.Unlock()
+			return string(pending[:n]), nil
+		}
+		if o.err != nil {
+			err := o.err
+			o.mu.Unlock()
+			return string(pending), err
+		}
+		updated := o.updated
+		o.mu.Unlock()
+
+		select {
+		case <-updated:
+		case <-expired:
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			return string(o.buf[o.off:]), ErrTimeout
+		}
+	}
+}
+
+// Block until s shows up in the output.
+// Everything up to and including s is consumed and returned.
+func (o *Output) WaitForString(s string, timeout time.Duration) (string, error) {
+	return o.WaitFor(func(pending []byte) int {
+		if i := bytes.Index(pending, []byte(s)); i >= 0 {
+			return i + len(s)
+		}
+		return -1
+	}, timeout)
+}
+
+// Everything read so far, consumed or not.
+func (o *Output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.buf)
+}
+
+// One-shot version of Output.WaitForString.
+// r should not be used afterwards as it keeps being read in the background.
+func WaitForString(r io.Reader, s string, timeout time.Duration) (string, error) {
+	return NewOutput(r).WaitForString(s, timeout)
+}
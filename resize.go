@@ -0,0 +1,45 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"errors"
+	"sync"
+)
+
+// Resize p to the size of the host terminal every time wake fires, until stop is
+// called or p is closed.
+func forwardHostSize[T any](p Backend, wake <-chan T, cleanup func()) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			cleanup()
+		})
+	}
+
+	go func() {
+		defer stop()
+		var last PtySize
+		for {
+			if size, err := GetHostSize(); err == nil && size != last {
+				if err := p.Resize(size); errors.Is(err, ErrAlreadyClosed) {
+					return
+				} else if err != nil {
+					reportBackground(p, "resize", err)
+				}
+				last = size
+			}
+			select {
+			case <-wake:
+			case <-p.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"testing"
+	"time"
+)
+
+type closingBackend struct {
+	Backend
+	done chan struct{}
+}
+
+func (b *closingBackend) Resize(PtySize) error {
+	return nil
+}
+
+func (b *closingBackend) Done() <-chan struct{} {
+	return b.done
+}
+
+// Forwarding stops as soon as the pty closes, without waiting for the next resize.
+func TestForwardHostSizeStopsOnClose(t *testing.T) {
+	p := &closingBackend{done: make(chan struct{})}
+	cleaned := make(chan struct{})
+	forwardHostSize(p, make(chan struct{}), func() { close(cleaned) })
+
+	close(p.done)
+	select {
+	case <-cleaned:
+	case <-time.After(time.Second):
+		t.Fatal("still forwarding after the pty closed")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package pty
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// Keep the size of p in sync with the host terminal using SIGWINCH,
+// until the returned function is called or p is closed.
+func BindHostResize(p Backend) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, unix.SIGWINCH)
+
+	return forwardHostSize(p, signals, func() {
+		signal.Stop(signals)
+	})
+}
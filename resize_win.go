@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"time"
+)
+
+// Consoles only report resizes as input events, which would steal input from
+// whoever reads stdin, so the size is polled instead.
+const hostResizePollInterval = 250 * time.Millisecond
+
+// Keep the size of p in sync with the host console until the returned function
+// is called or p is closed.
+func BindHostResize(p Backend) func() {
+	ticker := time.NewTicker(hostResizePollInterval)
+
+	return forwardHostSize(p, ticker.C, ticker.Stop)
+}
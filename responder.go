@@ -0,0 +1,414 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Color struct {
+	R, G, B uint8
+}
+
+// Colors reported to the child.
+type Theme struct {
+	Foreground Color
+	Background Color
+	Cursor     Color
+	// Indexed colors, queries for indexes past the end are not answered.
+	Palette []Color
+}
+
+type ColorTarget int
+
+const (
+	ColorPalette ColorTarget = iota
+	ColorForeground
+	ColorBackground
+	ColorCursor
+)
+
+// The child set a color.
+type ColorChange struct {
+	Target ColorTarget
+	// Index into the palette, only for ColorPalette.
+	Index int
+	// The color as sent by the child, e.g. "rgb:ffff/0000/0000" or "#ff0000".
+	Spec string
+}
+
+// Identity of the terminal reported to capability queries.
+type TerminalProfile struct {
+	// Parameters of the answer to DA1 (CSI c), e.g. "?62;22".
+	PrimaryDA string
+	// Parameters of the answer to DA2 (CSI > c), e.g. ">1;10;0".
+	SecondaryDA string
+	// Answers to XTGETTCAP (DCS + q) by capability name, missing ones are reported as unknown.
+	Capabilities map[string]string
+}
+
+func XtermProfile() TerminalProfile {
+	return TerminalProfile{
+		PrimaryDA:   "?64;1;2;6;9;15;18;21;22",
+		SecondaryDA: ">41;390;0",
+		Capabilities: map[string]string{
+			"TN":     "xterm-256color",
+			"name":   "xterm-256color",
+			"Co":     "256",
+			"colors": "256",
+		},
+	}
+}
+
+func VT220Profile() TerminalProfile {
+	return TerminalProfile{
+		PrimaryDA:   "?62;1;2;6;7;8;9",
+		SecondaryDA: ">1;10;0",
+		Capabilities: map[string]string{
+			"TN":   "vt220",
+			"name": "vt220",
+		},
+	}
+}
+
+type ResponderOptions struct {
+	// Answer XTWINOPS size reports (CSI 14 t, CSI 16 t and CSI 18 t) with the size of the pty.
+	// The pixel reports are only sent if PtySize has pixel dimensions.
+	WindowSize bool
+
+	// Answer color queries (OSC 4, 10, 11 and 12) with this theme, nil disables them.
+	Theme *Theme
+
+	// Called when the child sets a color with OSC 4, 10, 11 or 12.
+	OnColorChange func(ColorChange)
+
+	// Answer device attributes (DA1, DA2) and XTGETTCAP queries as this terminal,
+	// nil disables them.
+	Profile *TerminalProfile
+
+	// Answer cursor position reports (CSI 6 n and CSI ? 6 n) with the 1-based position
+	// returned by this, nil disables them. Returning false leaves the query to someone
+	// else, e.g. because a frontend is attached that answers it.
+	// Children hang waiting for the answer if nobody does.
+	CursorPosition func() (row, col int, ok bool)
+}
+
+func DefaultResponderOptions() ResponderOptions {
+	return ResponderOptions{
+		WindowSize: true,
+	}
+}
+
+// Responder answers queries the child sends to the terminal, for hosts that
+// don't have a real terminal attached to do it. Queries are not removed from
+// the output.
+type Responder struct {
+	r       io.Reader
+	w       io.Writer
+	pty     Backend
+	opts    ResponderOptions
+	scanner vtScanner
+	replies []byte
+}
+
+// Wrap r, the reader of pty, so queries found in the output are answered through w.
+// w can be shared with other writers to the pty.
+// Errors writing the answers are ignored since there is nobody left to answer.
+func NewResponder(pty Backend, r io.Reader, w io.Writer, opts ResponderOptions) *Responder {
+	return &Responder{
+		r:    r,
+		w:    w,
+		pty:  pty,
+		opts: opts,
+	}
+}
+
+func (r *Responder) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.scanner.scan(b[:n], r.respond)
+	if len(r.replies) > 0 {
+		r.w.Write(r.replies)
+		r.replies = r.replies[:0]
+	}
+	return n, err
+}
+
+func (r *Responder) respond(seq vtSequence) {
+	switch seq.kind {
+	case vtCSI:
+		switch {
+		case seq.final == 't' && r.opts.WindowSize:
+			r.windowSize(string(seq.params))
+		case seq.final == 'c' && r.opts.Profile != nil:
+			r.deviceAttributes(string(seq.params))
+		case seq.final == 'n' && r.opts.CursorPosition != nil:
+			r.cursorPosition(string(seq.params))
+		}
+	case vtOSC:
+		code, rest, _ := strings.Cut(string(seq.params), ";")
+		switch code {
+		case "4":
+			r.palette(rest, seq.terminator())
+		case "10", "11", "12":
+			r.dynamicColors(code, rest, seq.terminator())
+		}
+	case vtDCS:
+		if names, ok := strings.CutPrefix(string(seq.params), "+q"); ok && r.opts.Profile != nil {
+			r.capabilities(names)
+		}
+	}
+}
+
+func (r *Responder) cursorPosition(params string) {
+	if params != "6" && params != "?6" {
+		return
+	}
+	row, col, ok := r.opts.CursorPosition()
+	if !ok {
+		return
+	}
+	if params == "?6" {
+		r.reply("\x1b[?%d;%dR", row, col)
+	} else {
+		r.reply("\x1b[%d;%dR", row, col)
+	}
+}
+
+func (r *Responder) deviceAttributes(params string) {
+	switch params {
+	case "", "0":
+		r.reply("\x1b[%sc", r.opts.Profile.PrimaryDA)
+	case ">", ">0":
+		r.reply("\x1b[%sc", r.opts.Profile.SecondaryDA)
+	}
+}
+
+// DCS + q name [; name ...] ST with hex encoded names
+func (r *Responder) capabilities(names string) {
+	for _, name := range strings.Split(names, ";") {
+		decoded, err := hex.DecodeString(name)
+		if err != nil {
+			continue
+		}
+		value, ok := r.opts.Profile.Capabilities[string(decoded)]
+		if !ok {
+			r.reply("\x1bP0+r%s\x1b\\", name)
+			continue
+		}
+		r.reply("\x1bP1+r%s=%s\x1b\\", name, hex.EncodeToString([]byte(value)))
+	}
+}
+
+// OSC 4 ; index ; spec [; index ; spec ...]
+func (r *Responder) palette(params string, st string) {
+	parts := strings.Split(params, ";")
+	for i := 0; i+1 < len(parts); i += 2 {
+		index, err := strconv.Atoi(parts[i])
+		if err != nil || index < 0 {
+			continue
+		}
+		if parts[i+1] != "?" {
+			r.colorChanged(ColorChange{Target: ColorPalette, Index: index, Spec: parts[i+1]})
+			continue
+		}
+		if r.opts.Theme != nil && index < len(r.opts.Theme.Palette) {
+			r.reply("\x1b]4;%d;%s%s", index, r.opts.Theme.Palette[index].spec(), st)
+		}
+	}
+}
+
+// OSC 10 ; spec [; spec ...], every spec after the first one is for the next code
+func (r *Responder) dynamicColors(code string, params string, st string) {
+	first, _ := strconv.Atoi(code)
+	for i, spec := range strings.Split(params, ";") {
+		target := ColorTarget(first - 10 + int(ColorForeground) + i)
+		if target > ColorCursor {
+			break
+		}
+		if spec != "?" {
+			r.colorChanged(ColorChange{Target: target, Spec: spec})
+			continue
+		}
+		if r.opts.Theme == nil {
+			continue
+		}
+		var color Color
+		switch target {
+		case ColorForeground:
+			color = r.opts.Theme.Foreground
+		case ColorBackground:
+			color = r.opts.Theme.Background
+		case ColorCursor:
+			color = r.opts.Theme.Cursor
+		}
+		r.reply("\x1b]%d;%s%s", first+i, color.spec(), st)
+	}
+}
+
+func (r *Responder) colorChanged(change ColorChange) {
+	if r.opts.OnColorChange != nil {
+		r.opts.OnColorChange(change)
+	}
+}
+
+// Color in the format xterm uses for its answers.
+func (c Color) spec() string {
+	return fmt.Sprintf("rgb:%02x%02x/%02x%02x/%02x%02x", c.R, c.R, c.G, c.G, c.B, c.B)
+}
+
+func (r *Responder) windowSize(params string) {
+	size, err := r.pty.GetSize()
+	if err != nil && err != ErrSizeDiverged {
+		return
+	}
+	switch params {
+	case "14":
+		if size.PixelWidth != 0 && size.PixelHeight != 0 {
+			r.reply("\x1b[4;%d;%dt", size.PixelHeight, size.PixelWidth)
+		}
+	case "16":
+		if width, height := size.CellSize(); width != 0 && height != 0 {
+			r.reply("\x1b[6;%d;%dt", height, width)
+		}
+	case "18":
+		r.reply("\x1b[8;%d;%dt", size.Rows, size.Cols)
+	}
+}
+
+func (r *Responder) reply(format string, args ...any) {
+	r.replies = fmt.Appendf(r.replies, format, args...)
+}
+
+type vtKind int
+
+const (
+	vtCSI vtKind = iota
+	vtOSC
+	vtDCS
+)
+
+// A complete control sequence found in the output.
+type vtSequence struct {
+	kind vtKind
+	// parameter and intermediate bytes for CSI, the payload for OSC and DCS
+	params []byte
+	// final byte for CSI
+	final byte
+	// OSC terminated by BEL instead of ST
+	bel bool
+}
+
+// Terminator to use for answers, the same as the query used.
+func (s vtSequence) terminator() string {
+	if s.bel {
+		return "\x07"
+	}
+	return "\x1b\\"
+}
+
+type vtState int
+
+const (
+	vtGround vtState = iota
+	vtEscape
+	vtCSIParams
+	vtString
+	vtStringEscape
+)
+
+// Longer sequences are not queries, they are skipped without being buffered.
+const vtMaxParams = 256
+
+// Finds CSI, OSC and DCS sequences in a byte stream, which can be split
+// at arbitrary points between calls to scan.
+type vtScanner struct {
+	state    vtState
+	kind     vtKind
+	params   []byte
+	overflow bool
+}
+
+func (s *vtScanner) scan(b []byte, emit func(vtSequence)) {
+	for _, c := range b {
+		switch s.state {
+		case vtGround:
+			if c == 0x1b {
+				s.state = vtEscape
+			}
+		case vtEscape:
+			s.escape(c)
+		case vtCSIParams:
+			switch {
+			case c == 0x1b:
+				s.state = vtEscape
+			case c >= 0x20 && c <= 0x3f:
+				s.push(c)
+			case c >= 0x40 && c <= 0x7e:
+				if !s.overflow {
+					emit(vtSequence{kind: vtCSI, params: s.params, final: c})
+				}
+				s.state = vtGround
+			}
+		case vtString:
+			switch c {
+			case 0x07:
+				// BEL only terminates OSC
+				if s.kind == vtOSC {
+					s.end(emit, true)
+				} else {
+					s.push(c)
+				}
+			case 0x1b:
+				s.state = vtStringEscape
+			default:
+				s.push(c)
+			}
+		case vtStringEscape:
+			if c == '\\' {
+				s.end(emit, false)
+			} else {
+				s.escape(c)
+			}
+		}
+	}
+}
+
+func (s *vtScanner) escape(c byte) {
+	s.params = s.params[:0]
+	s.overflow = false
+	switch c {
+	case '[':
+		s.kind = vtCSI
+		s.state = vtCSIParams
+	case ']':
+		s.kind = vtOSC
+		s.state = vtString
+	case 'P':
+		s.kind = vtDCS
+		s.state = vtString
+	case 0x1b:
+		s.state = vtEscape
+	default:
+		s.state = vtGround
+	}
+}
+
+func (s *vtScanner) push(c byte) {
+	if len(s.params) >= vtMaxParams {
+		s.overflow = true
+		return
+	}
+	s.params = append(s.params, c)
+}
+
+func (s *vtScanner) end(emit func(vtSequence), bel bool) {
+	if !s.overflow {
+		emit(vtSequence{kind: s.kind, params: s.params, bel: bel})
+	}
+	s.state = vtGround
+}
@@ -0,0 +1,281 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type sizeBackend struct {
+	Backend
+	size PtySize
+	err  error
+}
+
+func (b *sizeBackend) GetSize() (PtySize, error) {
+	return b.size, b.err
+}
+
+type responderCase struct {
+	name    string
+	in      string
+	replies string
+}
+
+// Feed every case through a Responder whole and one byte at a time, the output
+// has to stay the same and the replies have to match.
+func testResponder(t *testing.T, p Backend, opts ResponderOptions, cases []responderCase) {
+	t.Helper()
+	for _, tc := range cases {
+		for split, r := range map[string]io.Reader{
+			"whole":    strings.NewReader(tc.in),
+			"one byte": iotest.OneByteReader(strings.NewReader(tc.in)),
+		} {
+			var replies bytes.Buffer
+			out, err := io.ReadAll(NewResponder(p, r, &replies, opts))
+			if err != nil || string(out) != tc.in {
+				t.Errorf("%s, %s: output %q, %v, want %q", tc.name, split, out, err, tc.in)
+			}
+			if replies.String() != tc.replies {
+				t.Errorf("%s, %s: replied %q, want %q", tc.name, split, replies.String(), tc.replies)
+			}
+		}
+	}
+}
+
+func TestResponderWindowSize(t *testing.T) {
+	pixels := PtySize{Rows: 24, Cols: 80, PixelWidth: 800, PixelHeight: 480}
+	for name, backend := range map[string]*sizeBackend{
+		"pixels": {size: pixels},
+		// the last known size is still the best answer
+		"diverged": {size: pixels, err: ErrSizeDiverged},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testResponder(t, backend, DefaultResponderOptions(), []responderCase{
+				{"text", "plain\r\n", ""},
+				{"cells", "\x1b[18t", "\x1b[8;24;80t"},
+				{"pixels", "\x1b[14t", "\x1b[4;480;800t"},
+				{"cell pixels", "\x1b[16t", "\x1b[6;20;10t"},
+				{"several", "a\x1b[18tb\x1b[14t", "\x1b[8;24;80t\x1b[4;480;800t"},
+				{"other", "\x1b[22;0t\x1b[19t\x1b[18m", ""},
+			})
+		})
+	}
+
+	t.Run("no pixels", func(t *testing.T) {
+		testResponder(t, &sizeBackend{size: DefaultPtySize()}, DefaultResponderOptions(), []responderCase{
+			{"cells", "\x1b[18t", "\x1b[8;24;80t"},
+			{"pixels", "\x1b[14t", ""},
+			{"cell pixels", "\x1b[16t", ""},
+		})
+	})
+	t.Run("size error", func(t *testing.T) {
+		testResponder(t, &sizeBackend{size: pixels, err: ErrAlreadyClosed}, DefaultResponderOptions(), []responderCase{
+			{"cells", "\x1b[18t", ""},
+		})
+	})
+	t.Run("disabled", func(t *testing.T) {
+		testResponder(t, &sizeBackend{size: pixels}, ResponderOptions{}, []responderCase{
+			{"cells", "\x1b[18t", ""},
+		})
+	})
+}
+
+func TestVTScanner(t *testing.T) {
+	long := strings.Repeat("9", vtMaxParams+1)
+	for _, tc := range []struct {
+		name string
+		in   string
+		want []vtSequence
+	}{
+		{"text", "plain\r\n", nil},
+		{"CSI", "a\x1b[?6nb", []vtSequence{{kind: vtCSI, params: []byte("?6"), final: 'n'}}},
+		{"CSI without params", "\x1b[c", []vtSequence{{kind: vtCSI, final: 'c'}}},
+		{"CSI intermediate", "\x1b[0 q", []vtSequence{{kind: vtCSI, params: []byte("0 "), final: 'q'}}},
+		{"CSI skips controls", "\x1b[1\n8t", []vtSequence{{kind: vtCSI, params: []byte("18"), final: 't'}}},
+		{"CSI cancelled", "\x1b[1\x1b[2J", []vtSequence{{kind: vtCSI, params: []byte("2"), final: 'J'}}},
+		{"OSC BEL", "\x1b]10;?\x07", []vtSequence{{kind: vtOSC, params: []byte("10;?"), bel: true}}},
+		{"OSC ST", "\x1b]11;?\x1b\\", []vtSequence{{kind: vtOSC, params: []byte("11;?")}}},
+		{"DCS", "\x1bP+q544e\x1b\\", []vtSequence{{kind: vtDCS, params: []byte("+q544e")}}},
+		{"DCS keeps BEL", "\x1bPa\x07b\x1b\\", []vtSequence{{kind: vtDCS, params: []byte("a\x07b")}}},
+		{"OSC cancelled", "\x1b]0;t\x1b[m", []vtSequence{{kind: vtCSI, final: 'm'}}},
+		{"other escapes", "\x1b7\x1b(B\x1b\x1b[m", []vtSequence{{kind: vtCSI, final: 'm'}}},
+		{"several", "\x1b[6n\x1b]4;1;?\x07", []vtSequence{
+			{kind: vtCSI, params: []byte("6"), final: 'n'},
+			{kind: vtOSC, params: []byte("4;1;?"), bel: true},
+		}},
+		{"overflow", "\x1b[" + long + "n\x1b]" + long + "\x07\x1b[5n", []vtSequence{{kind: vtCSI, params: []byte("5"), final: 'n'}}},
+	} {
+		for _, size := range []int{len(tc.in), 1, 3} {
+			var s vtScanner
+			var got []vtSequence
+			for in := tc.in; len(in) > 0; {
+				n := min(size, len(in))
+				s.scan([]byte(in[:n]), func(seq vtSequence) {
+					seq.params = append([]byte(nil), seq.params...)
+					got = append(got, seq)
+				})
+				in = in[n:]
+			}
+			if !equalSequences(got, tc.want) {
+				t.Errorf("%s, %d bytes at a time: got %v, want %v", tc.name, size, got, tc.want)
+			}
+			if s.state != vtGround {
+				t.Errorf("%s, %d bytes at a time: ended in state %d", tc.name, size, s.state)
+			}
+		}
+	}
+}
+
+func equalSequences(a, b []vtSequence) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].kind != b[i].kind || string(a[i].params) != string(b[i].params) ||
+			a[i].final != b[i].final || a[i].bel != b[i].bel {
+			return false
+		}
+	}
+	return true
+}
+
+func TestResponderColors(t *testing.T) {
+	theme := &Theme{
+		Foreground: Color{0xff, 0xff, 0xff},
+		Background: Color{0x00, 0x00, 0x00},
+		Cursor:     Color{0x12, 0x34, 0x56},
+		Palette:    []Color{{0x00, 0x00, 0x00}, {0xcd, 0x00, 0x00}},
+	}
+	const (
+		white = "rgb:ffff/ffff/ffff"
+		black = "rgb:0000/0000/0000"
+		red   = "rgb:cdcd/0000/0000"
+	)
+	backend := &sizeBackend{size: DefaultPtySize()}
+	testResponder(t, backend, ResponderOptions{Theme: theme}, []responderCase{
+		{"palette BEL", "\x1b]4;1;?\x07", "\x1b]4;1;" + red + "\x07"},
+		{"palette ST", "\x1b]4;1;?\x1b\\", "\x1b]4;1;" + red + "\x1b\\"},
+		{"several indexes", "\x1b]4;0;?;1;?\x07", "\x1b]4;0;" + black + "\x07\x1b]4;1;" + red + "\x07"},
+		{"past the palette", "\x1b]4;2;?\x07\x1b]4;-1;?\x07\x1b]4;x;?\x07", ""},
+		{"foreground", "\x1b]10;?\x07", "\x1b]10;" + white + "\x07"},
+		{"background", "\x1b]11;?\x1b\\", "\x1b]11;" + black + "\x1b\\"},
+		{"cursor", "\x1b]12;?\x07", "\x1b]12;rgb:1212/3434/5656\x07"},
+		// every further spec is for the next code
+		{"several dynamic", "\x1b]10;?;?;?;?\x07", "\x1b]10;" + white + "\x07\x1b]11;" + black + "\x07\x1b]12;rgb:1212/3434/5656\x07"},
+		{"from background", "\x1b]11;?;?\x07", "\x1b]11;" + black + "\x07\x1b]12;rgb:1212/3434/5656\x07"},
+		{"title", "\x1b]0;?\x07", ""},
+	})
+	testResponder(t, backend, ResponderOptions{}, []responderCase{
+		{"without theme", "\x1b]4;1;?\x07\x1b]10;?\x07", ""},
+	})
+}
+
+func TestResponderColorChange(t *testing.T) {
+	var changes []ColorChange
+	opts := ResponderOptions{
+		Theme:         &Theme{Background: Color{1, 2, 3}},
+		OnColorChange: func(change ColorChange) { changes = append(changes, change) },
+	}
+	var replies bytes.Buffer
+	in := "\x1b]4;3;#ff0000;5;?\x07\x1b]10;red;?\x07\x1b]12;rgb:ff/00/00\x1b\\"
+	io.ReadAll(NewResponder(&sizeBackend{}, strings.NewReader(in), &replies, opts))
+
+	want := []ColorChange{
+		{Target: ColorPalette, Index: 3, Spec: "#ff0000"},
+		{Target: ColorForeground, Spec: "red"},
+		{Target: ColorCursor, Spec: "rgb:ff/00/00"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got %+v, want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: got %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+	// queries mixed in are still answered
+	if want := "\x1b]11;rgb:0101/0202/0303\x07"; replies.String() != want {
+		t.Errorf("replied %q, want %q", replies.String(), want)
+	}
+}
+
+func TestResponderProfile(t *testing.T) {
+	profile := XtermProfile()
+	backend := &sizeBackend{size: DefaultPtySize()}
+	name := hex.EncodeToString([]byte("TN"))
+	value := hex.EncodeToString([]byte("xterm-256color"))
+	colors := hex.EncodeToString([]byte("colors"))
+	unknown := hex.EncodeToString([]byte("xx"))
+	testResponder(t, backend, ResponderOptions{Profile: &profile}, []responderCase{
+		{"DA1", "\x1b[c", "\x1b[" + profile.PrimaryDA + "c"},
+		{"DA1 0", "\x1b[0c", "\x1b[" + profile.PrimaryDA + "c"},
+		{"DA2", "\x1b[>c", "\x1b[" + profile.SecondaryDA + "c"},
+		{"DA2 0", "\x1b[>0c", "\x1b[" + profile.SecondaryDA + "c"},
+		{"DA3", "\x1b[=c", ""},
+		{"XTGETTCAP", "\x1bP+q" + name + "\x1b\\", "\x1bP1+r" + name + "=" + value + "\x1b\\"},
+		{"unknown capability", "\x1bP+q" + unknown + "\x1b\\", "\x1bP0+r" + unknown + "\x1b\\"},
+		{"several capabilities", "\x1bP+q" + colors + ";" + unknown + "\x1b\\",
+			"\x1bP1+r" + colors + "=" + hex.EncodeToString([]byte("256")) + "\x1b\\\x1bP0+r" + unknown + "\x1b\\"},
+		{"not hex", "\x1bP+qzz\x1b\\", ""},
+		{"other DCS", "\x1bP$qm\x1b\\", ""},
+	})
+	testResponder(t, backend, ResponderOptions{}, []responderCase{
+		{"without profile", "\x1b[c\x1b[>c\x1bP+q" + name + "\x1b\\", ""},
+	})
+}
+
+func TestResponderCursorPosition(t *testing.T) {
+	backend := &sizeBackend{size: DefaultPtySize()}
+	at := func(row, col int, ok bool) ResponderOptions {
+		return ResponderOptions{CursorPosition: func() (int, int, bool) { return row, col, ok }}
+	}
+	testResponder(t, backend, at(3, 5, true), []responderCase{
+		{"CPR", "\x1b[6n", "\x1b[3;5R"},
+		{"DECXCPR", "\x1b[?6n", "\x1b[?3;5R"},
+		{"status", "\x1b[5n", ""},
+	})
+	// someone else answers
+	testResponder(t, backend, at(3, 5, false), []responderCase{
+		{"not ok", "\x1b[6n\x1b[?6n", ""},
+	})
+	testResponder(t, backend, ResponderOptions{}, []responderCase{
+		{"disabled", "\x1b[6n", ""},
+	})
+}
+
+func FuzzVTScanner(f *testing.F) {
+	for _, seed := range []string{
+		"\x1b[?6n", "\x1b]10;?\x07", "\x1b]11;?\x1b\\", "\x1bP+q544e\x1b\\", "\x1b[1\x1b[2J",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		// how the input is split doesn't change what is found
+		var whole, split []vtSequence
+		var s vtScanner
+		s.scan(in, func(seq vtSequence) {
+			seq.params = append([]byte(nil), seq.params...)
+			whole = append(whole, seq)
+		})
+		s = vtScanner{}
+		for i := range in {
+			s.scan(in[i:i+1], func(seq vtSequence) {
+				if len(seq.params) > vtMaxParams {
+					t.Fatalf("%d bytes of params", len(seq.params))
+				}
+				seq.params = append([]byte(nil), seq.params...)
+				split = append(split, seq)
+			})
+		}
+		if !equalSequences(whole, split) {
+			t.Fatalf("whole %v, one byte at a time %v", whole, split)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+type SendOptions struct {
+	// Wrap the content in bracketed paste sequences so shells treat it as pasted text.
+	// Paste end sequences inside the content are removed.
+	BracketedPaste bool
+
+	// Maximum number of bytes written at once. 0 writes everything at once.
+	ChunkSize int
+
+	// Pause between chunks so the line discipline of the child can keep up.
+	Delay time.Duration
+
+	// Clock the pauses are measured with, nil is the system clock.
+	Clock Clock
+}
+
+func DefaultSendOptions() SendOptions {
+	return SendOptions{
+		BracketedPaste: true,
+		ChunkSize:      256,
+		Delay:          10 * time.Millisecond,
+	}
+}
+
+// Write the contents of the file at path into w, usually the writer of a pty.
+func SendFile(w io.Writer, path string, opts SendOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return Send(w, f, opts)
+}
+
+// Write everything from r into w in chunks while it is being read, so large
+// files don't have to fit in memory.
+func Send(w io.Writer, r io.Reader, opts SendOptions) error {
+	s := sender{w: w, opts: opts, clock: clockOrSystem(opts.Clock)}
+	if opts.BracketedPaste {
+		s.ready = append(s.ready, pasteStart...)
+	}
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buffer)
+		if opts.BracketedPaste {
+			s.strip(buffer[:n])
+		} else {
+			s.ready = append(s.ready, buffer[:n]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.send(false); err != nil {
+			return err
+		}
+	}
+
+	if opts.BracketedPaste {
+		// nothing can complete an end sequence anymore
+		s.ready = append(append(s.ready, s.held...), pasteEnd...)
+	}
+	return s.send(true)
+}
+
+type sender struct {
+	w     io.Writer
+	opts  SendOptions
+	clock Clock
+	// content that is final
+	ready []byte
+	// content that could still turn into a paste end sequence
+	held []byte
+	// at least one chunk was written
+	started bool
+}
+
+// Remove paste end sequences from b, including ones that only form once an inner
+// one is removed, so held can grow past a single partial sequence.
+func (s *sender) strip(b []byte) {
+	for _, c := range b {
+		s.held = append(s.held, c)
+		if bytes.HasSuffix(s.held, []byte(pasteEnd)) {
+			s.held = s.held[:len(s.held)-len(pasteEnd)]
+		}
+	}
+
+	// held is split at ESCs, only a run of segments at the end that are all
+	// beginnings of an end sequence can still change
+	final := len(s.held)
+	for final > 0 {
+		start := bytes.LastIndexByte(s.held[:final], 0x1b)
+		if start < 0 || !bytes.HasPrefix([]byte(pasteEnd), s.held[start:final]) {
+			break
+		}
+		final = start
+	}
+	s.ready = append(s.ready, s.held[:final]...)
+	s.held = s.held[:copy(s.held, s.held[final:])]
+}
+
+// Write full chunks of ready, everything if last.
+func (s *sender) send(last bool) error {
+	size := s.opts.ChunkSize
+	if size <= 0 {
+		size = len(s.ready)
+	}
+	sent := 0
+	for len(s.ready)-sent > 0 && (last || len(s.ready)-sent >= size) {
+		if s.started && s.opts.Delay > 0 {
+			<-s.clock.After(s.opts.Delay)
+		}
+		n := min(size, len(s.ready)-sent)
+		if _, err := s.w.Write(s.ready[sent : sent+n]); err != nil {
+			return err
+		}
+		s.started = true
+		sent += n
+	}
+	s.ready = s.ready[:copy(s.ready, s.ready[sent:])]
+	return nil
+}
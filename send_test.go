@@ -0,0 +1,130 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// chunks records every write.
+type chunks [][]byte
+
+func (c *chunks) Write(b []byte) (int, error) {
+	*c = append(*c, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestSendStripsPasteEnd(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a\x1b[201~b", "ab"},
+		// removing the inner one forms another
+		{"a\x1b[20\x1b[201~1~b", "ab"},
+		{"\x1b[2\x1b[20\x1b[201~1~01~", ""},
+		{"\x1b[201", "\x1b[201"},
+		{"\x1b[A\x1b[201~\x1b", "\x1b[A\x1b"},
+	} {
+		for name, r := range map[string]io.Reader{
+			"whole":    strings.NewReader(tc.in),
+			"one byte": iotest.OneByteReader(strings.NewReader(tc.in)),
+		} {
+			var out bytes.Buffer
+			err := Send(&out, r, SendOptions{BracketedPaste: true, ChunkSize: 3})
+			want := pasteStart + tc.want + pasteEnd
+			if err != nil || out.String() != want {
+				t.Errorf("%q %s: got %q, %v, want %q", tc.in, name, out.String(), err, want)
+			}
+		}
+	}
+}
+
+func TestSendChunks(t *testing.T) {
+	var out chunks
+	if err := Send(&out, iotest.OneByteReader(strings.NewReader("abcdefg")), SendOptions{ChunkSize: 3}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"abc", "def", "g"}
+	if len(out) != len(want) {
+		t.Fatalf("got %q, want %q", out, want)
+	}
+	for i := range want {
+		if string(out[i]) != want[i] {
+			t.Errorf("chunk %d: got %q, want %q", i, out[i], want[i])
+		}
+	}
+}
+
+// Chunks go out while the reader still has more to come.
+func TestSendStreams(t *testing.T) {
+	r, w := io.Pipe()
+	out := make(chan []byte, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- Send(writerFunc(func(b []byte) (int, error) {
+			out <- append([]byte(nil), b...)
+			return len(b), nil
+		}), r, SendOptions{BracketedPaste: true, ChunkSize: 4})
+	}()
+
+	w.Write([]byte("12345678"))
+	for _, want := range []string{pasteStart[:4], pasteStart[4:] + "12", "3456"} {
+		select {
+		case got := <-out:
+			if string(got) != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("nothing written before the end of the input")
+		}
+	}
+	w.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+func FuzzSend(f *testing.F) {
+	for _, seed := range []string{
+		"plain", "a\x1b[201~b", "a\x1b[20\x1b[201~1~b", "\x1b[2\x1b[20\x1b[201~1~01~", "\x1b[A\x1b[201~\x1b",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var whole, split bytes.Buffer
+		opts := SendOptions{BracketedPaste: true, ChunkSize: 3}
+		if err := Send(&whole, bytes.NewReader(in), opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := Send(&split, iotest.OneByteReader(bytes.NewReader(in)), opts); err != nil {
+			t.Fatal(err)
+		}
+		if whole.String() != split.String() {
+			t.Fatalf("whole %q, one byte at a time %q", whole.String(), split.String())
+		}
+		// nothing in the paste can end it early
+		body, ok := strings.CutPrefix(whole.String(), pasteStart)
+		body, ok2 := strings.CutSuffix(body, pasteEnd)
+		if !ok || !ok2 || strings.Contains(body, pasteEnd) {
+			t.Fatalf("got %q from %q", whole.String(), in)
+		}
+		// without end sequences nothing is removed
+		if !bytes.Contains(in, []byte(pasteEnd)) && body != string(in) {
+			t.Fatalf("got %q from %q", body, in)
+		}
+	})
+}
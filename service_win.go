@@ -0,0 +1,50 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+var ErrNoActiveSession = errors.New("no active session")
+
+// Get a token of the user logged on to the physical console, for spawning
+// children from a service into the session of that user instead of Session 0.
+// Set it as cmd.SysProcAttr.Token before SpawnCommand and close it afterwards.
+// The environment of the user can be built with token.Environ.
+//
+// The caller has to run as LocalSystem, which services usually do.
+func ActiveUserToken() (windows.Token, error) {
+	session := windows.WTSGetActiveConsoleSessionId()
+	if session == 0xFFFFFFFF {
+		return 0, ErrNoActiveSession
+	}
+	return SessionUserToken(session)
+}
+
+// Get a token of the user logged on to the given session, see ActiveUserToken.
+func SessionUserToken(session uint32) (windows.Token, error) {
+	var token windows.Token
+	if err := windows.WTSQueryUserToken(session, &token); err != nil {
+		logger.Println(err)
+		return 0, err
+	}
+	defer token.Close()
+
+	var dup windows.Token
+	if err := windows.DuplicateTokenEx(
+		token,
+		windows.MAXIMUM_ALLOWED,
+		nil,
+		windows.SecurityImpersonation,
+		windows.TokenPrimary,
+		&dup,
+	); err != nil {
+		logger.Println(err)
+		return 0, err
+	}
+	return dup, nil
+}
@@ -0,0 +1,126 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+type ShellSyntax int
+
+const (
+	// sh, bash, zsh and friends
+	ShellPOSIX ShellSyntax = iota
+	ShellPowerShell
+	ShellCmd
+)
+
+// Shell runs commands in an interactive shell that already runs in a pty and waits
+// for them to finish, so automation can reuse a warm shell instead of spawning
+// a process per command.
+//
+// Completion is detected by echoing a sentinel with the exit code after the command.
+type Shell struct {
+	mu       sync.Mutex
+	w        io.Writer
+	syntax   ShellSyntax
+	stream   *Stream
+	pending  []byte
+	sentinel string
+	runs     int
+}
+
+// r and w are the reader and writer of the pty, r must not be used by anything else.
+// Fails only if no random sentinel could be made.
+func NewShell(r io.Reader, w io.Writer, syntax ShellSyntax) (*Shell, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &Shell{
+		w:        w,
+		syntax:   syntax,
+		stream:   NewStream(r, DefaultStreamOptions()),
+		sentinel: "__GOPTY_" + hex.EncodeToString(nonce),
+	}, nil
+}
+
+// Stop reading the pty and return its reader, see Stream.Stop.
+// Runs in progress fail with io.ErrUnexpectedEOF.
+func (s *Shell) Stop() io.Reader {
+	return s.stream.Stop()
+}
+
+// Run command and return its output and exit code.
+// The output is what the pty printed between the echo of the command and the
+// sentinel, escape sequences included.
+// The sentinel is part of the same line as command, so commands reading input
+// don't swallow it.
+func (s *Shell) Run(ctx context.Context, command string) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs++
+	marker := fmt.Sprintf("%s_%d_", s.sentinel, s.runs)
+	// the echo of the typed line contains the marker too, but not followed by digits
+	done := regexp.MustCompile(regexp.QuoteMeta(marker) + `(-?[0-9]+)__`)
+
+	var line string
+	switch s.syntax {
+	case ShellPowerShell:
+		line = fmt.Sprintf("%s; echo \"%s$(if ($?) { 0 } elseif ($LASTEXITCODE) { $LASTEXITCODE } else { 1 })__\"\r", command, marker)
+	case ShellCmd:
+		// cmd.exe expands %errorlevel% when it parses the line, before command ran.
+		// At the prompt %^errorlevel% is left alone and loses its caret, call expands
+		// it again once it runs.
+		line = fmt.Sprintf("%s & call echo %s%%^errorlevel%%__\r", command, marker)
+	default:
+		line = fmt.Sprintf("%s; echo \"%s$?__\"\r", command, marker)
+	}
+	if _, err := s.w.Write([]byte(line)); err != nil {
+		return "", -1, err
+	}
+
+	for {
+		if match := done.FindSubmatchIndex(s.pending); match != nil {
+			output := s.pending[:match[0]]
+			// drop everything up to the end of the echo of the typed line, prompts included
+			if i := bytes.Index(output, []byte(marker)); i >= 0 {
+				output = output[i:]
+				if end := bytes.IndexByte(output, '\n'); end >= 0 {
+					output = output[end+1:]
+				} else {
+					output = nil
+				}
+			}
+			code, _ := strconv.Atoi(string(s.pending[match[2]:match[3]]))
+			result := string(output)
+			s.pending = s.pending[:copy(s.pending, s.pending[match[1]:])]
+			return result, code, nil
+		}
+
+		select {
+		case chunk, ok := <-s.stream.Output():
+			if !ok {
+				err := s.stream.Err()
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return string(s.pending), -1, err
+			}
+			s.pending = append(s.pending, chunk...)
+			s.stream.Release(chunk)
+		case <-ctx.Done():
+			return string(s.pending), -1, ctx.Err()
+		}
+	}
+}
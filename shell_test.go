@@ -0,0 +1,135 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var psStatus = regexp.MustCompile(`\$\(if .*\)`)
+
+// Plays an interactive shell on the other end of a pty: echoes every line, runs
+// the commands in it and prints a prompt, cmd.exe with a blank line in front.
+// "read" reads a line of input, reading signals when it starts.
+func fakeShell(syntax ShellSyntax, in io.Reader, out io.Writer, reading chan<- struct{}) {
+	status := 0
+	lines := bufio.NewReader(in)
+	prompt := func() {
+		switch syntax {
+		case ShellCmd:
+			fmt.Fprint(out, "\r\nC:\\>")
+		case ShellPowerShell:
+			fmt.Fprint(out, "PS C:\\> ")
+		default:
+			fmt.Fprint(out, "$ ")
+		}
+	}
+	// expands the exit code like the shell would when it is time to
+	expand := func(s string) string {
+		switch syntax {
+		case ShellCmd:
+			return strings.ReplaceAll(s, "%errorlevel%", fmt.Sprint(status))
+		case ShellPowerShell:
+			return psStatus.ReplaceAllString(strings.Trim(s, `"`), fmt.Sprint(status))
+		default:
+			return strings.ReplaceAll(strings.Trim(s, `"`), "$?", fmt.Sprint(status))
+		}
+	}
+
+	prompt()
+	for {
+		line, err := lines.ReadString('\r')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(line, "\r")
+		fmt.Fprintf(out, "%s\r\n", line)
+		separator := "; "
+		if syntax == ShellCmd {
+			// %errorlevel% is expanded for the whole line before any of it runs
+			line = strings.ReplaceAll(expand(line), "^", "")
+			separator = " & "
+		}
+		for _, command := range strings.Split(line, separator) {
+			command, call := strings.CutPrefix(command, "call ")
+			switch {
+			case command == "fail":
+				status = 1
+				fmt.Fprint(out, "failed\r\n")
+			case command == "ok":
+				status = 0
+				fmt.Fprint(out, "done\r\n")
+			case command == "read":
+				reading <- struct{}{}
+				input, _ := lines.ReadString('\r')
+				fmt.Fprintf(out, "%s\n", input)
+				status = 0
+			case strings.HasPrefix(command, "echo "):
+				arg := strings.TrimPrefix(command, "echo ")
+				if call || syntax != ShellCmd {
+					arg = expand(arg)
+				}
+				fmt.Fprintf(out, "%s\r\n", arg)
+			}
+		}
+		prompt()
+	}
+}
+
+func TestShellExitCodes(t *testing.T) {
+	for name, syntax := range map[string]ShellSyntax{
+		"posix":      ShellPOSIX,
+		"powershell": ShellPowerShell,
+		"cmd":        ShellCmd,
+	} {
+		inRead, inWrite := io.Pipe()
+		outRead, outWrite := io.Pipe()
+		reading := make(chan struct{})
+		go fakeShell(syntax, inRead, outWrite, reading)
+
+		shell, err := NewShell(outRead, inWrite, syntax)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		for _, tc := range []struct {
+			command string
+			output  string
+			code    int
+		}{
+			{"fail", "failed\r\n", 1},
+			{"ok", "done\r\n", 0},
+			{"fail", "failed\r\n", 1},
+			// the sentinel isn't taken as its input
+			{"read", "answer\r\n", 0},
+		} {
+			if tc.command == "read" {
+				go func() {
+					<-reading
+					inWrite.Write([]byte("answer\r"))
+				}()
+			}
+			output, code, err := shell.Run(ctx, tc.command)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, tc.command, err)
+			}
+			if code != tc.code {
+				t.Errorf("%s %s: exit code %d, want %d", name, tc.command, code, tc.code)
+			}
+			if output != tc.output {
+				t.Errorf("%s %s: output %q, want %q", name, tc.command, output, tc.output)
+			}
+		}
+		cancel()
+		inWrite.Close()
+	}
+}
@@ -0,0 +1,160 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+)
+
+// Priority of a spawned child relative to the host.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityIdle
+	PriorityBelowNormal
+	PriorityAboveNormal
+	PriorityHigh
+)
+
+type spawnConfig struct {
+	priority Priority
+	affinity uint64
+	dirCheck bool
+	// create the working directory with dirPerm if it doesn't exist
+	dirCreate bool
+	dirPerm   fs.FileMode
+	// Windows only
+	commandLine   string
+	token         uintptr
+	creationFlags uint32
+	handles       []uintptr
+	title         string
+	fillAttribute uint32
+	fill          bool
+}
+
+var ErrNotDir = errors.New("not a directory")
+
+// Wrapped around affinity masks the platform can't pass on, check with errors.Is.
+var ErrAffinity = errors.New("affinity mask out of range")
+
+// Returned by SpawnCommand and SpawnArgs for a working directory that doesn't
+// exist or couldn't be created.
+type DirError struct {
+	Path string
+	Err  error
+}
+
+func (e *DirError) Error() string {
+	return fmt.Sprintf("working directory %s: %v", e.Path, e.Err)
+}
+
+func (e *DirError) Unwrap() error {
+	return e.Err
+}
+
+// Option for Pty.SpawnCommand.
+type SpawnOption func(*spawnConfig)
+
+// Reject fields of cmd that have no effect since the child is attached to the pty,
+// instead of silently ignoring them.
+// A failed lookup recorded in cmd.Err, like exec.ErrDot, is returned as is.
+func checkCmd(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	field := ""
+	switch {
+	case cmd.Stdin != nil:
+		field = "Stdin"
+	case cmd.Stdout != nil:
+		field = "Stdout"
+	case cmd.Stderr != nil:
+		field = "Stderr"
+	case len(cmd.ExtraFiles) > 0:
+		field = "ExtraFiles"
+	case cmd.Cancel != nil:
+		field = "Cancel"
+	case cmd.WaitDelay != 0:
+		field = "WaitDelay"
+	case cmd.Process != nil:
+		field = "Process"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedField, field)
+}
+
+func newSpawnConfig(opts []SpawnOption) spawnConfig {
+	config := spawnConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// Run the child with the given priority class.
+// Only Windows honors it, Unix ignores spawn options until it has an implementation.
+func WithPriority(priority Priority) SpawnOption {
+	return func(c *spawnConfig) {
+		c.priority = priority
+	}
+}
+
+// Restrict the child to the CPUs set in mask. 0 means no restriction.
+// Masks wider than a pointer, CPUs above 31 on 32-bit builds, fail with ErrAffinity.
+func WithAffinity(mask uint64) SpawnOption {
+	return func(c *spawnConfig) {
+		c.affinity = mask
+	}
+}
+
+// Fail with a DirError before spawning if the working directory doesn't exist,
+// instead of an opaque error from process creation.
+func WithDirCheck() SpawnOption {
+	return func(c *spawnConfig) {
+		c.dirCheck = true
+	}
+}
+
+// Create the working directory and its parents with perm before spawning if it
+// doesn't exist.
+func WithDirCreate(perm fs.FileMode) SpawnOption {
+	return func(c *spawnConfig) {
+		c.dirCreate = true
+		c.dirPerm = perm
+	}
+}
+
+func (c *spawnConfig) checkAffinity() error {
+	if uint64(uintptr(c.affinity)) != c.affinity {
+		return fmt.Errorf("%w: %#x", ErrAffinity, c.affinity)
+	}
+	return nil
+}
+
+func (c *spawnConfig) prepareDir(dir string) error {
+	if dir == "" || (!c.dirCheck && !c.dirCreate) {
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) && c.dirCreate {
+		err = os.MkdirAll(dir, c.dirPerm)
+		if err == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return &DirError{Path: dir, Err: err}
+	}
+	if !info.IsDir() {
+		return &DirError{Path: dir, Err: ErrNotDir}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCmd(t *testing.T) {
+	lookup := exec.Command("sh")
+	lookup.Err = exec.ErrDot
+
+	for _, tc := range []struct {
+		name string
+		cmd  *exec.Cmd
+		want error
+	}{
+		{"plain", exec.Command("sh"), nil},
+		{"lookup failed", lookup, exec.ErrDot},
+		{"Stdin", &exec.Cmd{Path: "sh", Stdin: os.Stdin}, ErrUnsupportedField},
+		{"Stdout", &exec.Cmd{Path: "sh", Stdout: &bytes.Buffer{}}, ErrUnsupportedField},
+		{"ExtraFiles", &exec.Cmd{Path: "sh", ExtraFiles: []*os.File{os.Stdin}}, ErrUnsupportedField},
+		{"WaitDelay", &exec.Cmd{Path: "sh", WaitDelay: 1}, ErrUnsupportedField},
+	} {
+		if err := checkCmd(tc.cmd); !errors.Is(err, tc.want) || (tc.want == nil) != (err == nil) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestCheckAffinity(t *testing.T) {
+	narrow := ^uintptr(0) == math.MaxUint32
+	for _, tc := range []struct {
+		mask uint64
+		fail bool
+	}{
+		{0, false},
+		{0b1010, false},
+		{math.MaxUint32, false},
+		{1 << 32, narrow},
+		{math.MaxUint64, narrow},
+	} {
+		config := newSpawnConfig([]SpawnOption{WithAffinity(tc.mask)})
+		if err := config.checkAffinity(); errors.Is(err, ErrAffinity) != tc.fail {
+			t.Errorf("%#x: got %v", tc.mask, err)
+		}
+	}
+}
+
+func TestPrepareDir(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "missing")
+	// whatever the platform reports
+	anyErr := errors.New("any error")
+
+	for _, tc := range []struct {
+		name string
+		dir  string
+		opts []SpawnOption
+		err  error
+	}{
+		{"no check", missing, nil, nil},
+		{"no dir", "", []SpawnOption{WithDirCheck()}, nil},
+		{"exists", root, []SpawnOption{WithDirCheck()}, nil},
+		{"missing", missing, []SpawnOption{WithDirCheck()}, fs.ErrNotExist},
+		{"file", file, []SpawnOption{WithDirCheck()}, ErrNotDir},
+		{"file with create", file, []SpawnOption{WithDirCreate(0o700)}, ErrNotDir},
+		{"created", filepath.Join(missing, "a", "b"), []SpawnOption{WithDirCreate(0o700)}, nil},
+		{"under a file", filepath.Join(file, "a"), []SpawnOption{WithDirCreate(0o700)}, anyErr},
+	} {
+		config := newSpawnConfig(tc.opts)
+		err := config.prepareDir(tc.dir)
+		if tc.err == nil {
+			if err != nil {
+				t.Errorf("%s: got %v", tc.name, err)
+			}
+			continue
+		}
+		var dirErr *DirError
+		if !errors.As(err, &dirErr) || dirErr.Path != tc.dir {
+			t.Errorf("%s: got %v, want a DirError for %s", tc.name, err, tc.dir)
+			continue
+		}
+		if tc.err != anyErr && !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(missing, "a", "b")); err != nil || !info.IsDir() {
+		t.Errorf("not created: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// STARTUPINFO flag for FillAttribute, missing from x/sys/windows
+const startfUseFillAttribute = 0x10
+
+var (
+	modkernel32                = windows.NewLazySystemDLL("kernel32.dll")
+	procSetProcessAffinityMask = modkernel32.NewProc("SetProcessAffinityMask")
+)
+
+// Pass cmdLine to the child as is instead of building it from the arguments.
+func WithCommandLine(cmdLine string) SpawnOption {
+	return func(c *spawnConfig) {
+		c.commandLine = cmdLine
+	}
+}
+
+// Spawn the child as the user of token, see ElevatedToken and ActiveUserToken.
+// The same as setting cmd.SysProcAttr.Token.
+func WithToken(token windows.Token) SpawnOption {
+	return func(c *spawnConfig) {
+		c.token = uintptr(token)
+	}
+}
+
+// Let the child inherit handles, e.g. sockets or pipes for a sidecar protocol.
+// They are made inheritable, the child has to be told their values some other way,
+// e.g. through its arguments. The same as cmd.SysProcAttr.AdditionalInheritedHandles.
+func WithInheritedHandles(handles ...windows.Handle) SpawnOption {
+	return func(c *spawnConfig) {
+		for _, handle := range handles {
+			c.handles = append(c.handles, uintptr(handle))
+		}
+	}
+}
+
+// Title of the child's console in its STARTUPINFO, shown by Task Manager and other
+// tools to tell the conhost of a session apart. Defaults to the executable path.
+func WithTitle(title string) SpawnOption {
+	return func(c *spawnConfig) {
+		c.title = title
+	}
+}
+
+// Initial text and background colors of the console, a combination of the
+// FOREGROUND_* and BACKGROUND_* console attributes.
+func WithFillAttribute(attr uint16) SpawnOption {
+	return func(c *spawnConfig) {
+		c.fillAttribute = uint32(attr)
+		c.fill = true
+	}
+}
+
+// Extra CreateProcess flags, from cmd.SysProcAttr.CreationFlags.
+func withCreationFlags(flags uint32) SpawnOption {
+	return func(c *spawnConfig) {
+		c.creationFlags |= flags
+	}
+}
+
+func (p Priority) creationFlags() uint32 {
+	switch p {
+	case PriorityIdle:
+		return windows.IDLE_PRIORITY_CLASS
+	case PriorityBelowNormal:
+		return windows.BELOW_NORMAL_PRIORITY_CLASS
+	case PriorityAboveNormal:
+		return windows.ABOVE_NORMAL_PRIORITY_CLASS
+	case PriorityHigh:
+		return windows.HIGH_PRIORITY_CLASS
+	default:
+		return 0
+	}
+}
+
+func setProcessAffinityMask(process windows.Handle, mask uint64) error {
+	r1, _, err := procSetProcessAffinityMask.Call(uintptr(process), uintptr(mask))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
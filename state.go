@@ -0,0 +1,155 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"fmt"
+	"sync"
+)
+
+type phase int
+
+const (
+	phaseCreated phase = iota
+	phaseSpawned
+	phaseExited
+	phaseClosed
+)
+
+func (p phase) String() string {
+	switch p {
+	case phaseCreated:
+		return "created"
+	case phaseSpawned:
+		return "spawned"
+	case phaseExited:
+		return "child exited"
+	default:
+		return "closed"
+	}
+}
+
+// Returned when an operation is not valid in the current state of a Pty or Child.
+// Err is one of ErrAlreadyClosed or ErrAlreadySpawned, check with errors.Is.
+type StateError struct {
+	Op    string
+	State string
+	Err   error
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s in state %s: %v", e.Op, e.State, e.Err)
+}
+
+func (e *StateError) Unwrap() error {
+	return e.Err
+}
+
+// State machine shared by a pty and its child:
+// created -> spawned -> child exited -> closed.
+// Close is possible from any state.
+type lifecycle struct {
+	mu    sync.Mutex
+	phase phase
+	// phase Close was called in, the child can still be waited on if it was running
+	closedIn phase
+	// closed by close, made when first asked for
+	done chan struct{}
+}
+
+func (l *lifecycle) errorf(op string, err error) error {
+	return &StateError{Op: op, State: l.phase.String(), Err: err}
+}
+
+func (l *lifecycle) childRunning() bool {
+	return l.phase == phaseSpawned || (l.phase == phaseClosed && l.closedIn == phaseSpawned)
+}
+
+// Error if the pty is closed.
+func (l *lifecycle) check(op string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.phase == phaseClosed {
+		return l.errorf(op, ErrAlreadyClosed)
+	}
+	return nil
+}
+
+func (l *lifecycle) closed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.phase == phaseClosed
+}
+
+// Hold the lifecycle in the spawned state while spawn runs,
+// going back to created if it fails.
+func (l *lifecycle) spawn(spawn func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch l.phase {
+	case phaseCreated:
+	case phaseClosed:
+		return l.errorf("spawn", ErrAlreadyClosed)
+	default:
+		return l.errorf("spawn", ErrAlreadySpawned)
+	}
+
+	if err := spawn(); err != nil {
+		return err
+	}
+	l.phase = phaseSpawned
+	return nil
+}
+
+// Error if the child already exited.
+func (l *lifecycle) checkChild(op string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.childRunning() {
+		return l.errorf(op, ErrAlreadyClosed)
+	}
+	return nil
+}
+
+// Record that the child exited.
+func (l *lifecycle) exit(op string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.childRunning() {
+		return l.errorf(op, ErrAlreadyClosed)
+	}
+	if l.phase == phaseClosed {
+		l.closedIn = phaseExited
+	} else {
+		l.phase = phaseExited
+	}
+	return nil
+}
+
+// Channel closed once the pty is closed.
+func (l *lifecycle) closing() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done == nil {
+		l.done = make(chan struct{})
+		if l.phase == phaseClosed {
+			close(l.done)
+		}
+	}
+	return l.done
+}
+
+func (l *lifecycle) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.phase == phaseClosed {
+		return l.errorf("close", ErrAlreadyClosed)
+	}
+	l.closedIn = l.phase
+	l.phase = phaseClosed
+	if l.done != nil {
+		close(l.done)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import "testing"
+
+func TestLifecycleClosing(t *testing.T) {
+	var l lifecycle
+	done := l.closing()
+	l.close()
+	select {
+	case <-done:
+	default:
+		t.Fatal("not closed by close")
+	}
+	select {
+	case <-l.closing():
+	default:
+		t.Fatal("not closed when asked for after close")
+	}
+}
@@ -0,0 +1,241 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// What a Stream does when the consumer doesn't keep up.
+type Backpressure int
+
+const (
+	// Stop reading until the consumer catches up, the child blocks once the pipe is full.
+	BackpressureBlock Backpressure = iota
+	// Drop output the consumer isn't ready for.
+	BackpressureDrop
+)
+
+// Whether a Stream favors latency or throughput.
+type Latency int
+
+const (
+	// Deliver every read as soon as it completes, for interactive use.
+	LatencyLow Latency = iota
+	// Merge reads into chunks of up to CoalesceSize bytes, delivered at most
+	// CoalesceDelay after their first byte, for bulk output like logs.
+	LatencyThroughput
+)
+
+type StreamOptions struct {
+	// Size of the buffer every read goes to.
+	ChunkSize int
+
+	// Number of chunks waiting for the consumer before Backpressure applies.
+	Queue int
+
+	Backpressure Backpressure
+
+	Latency       Latency
+	CoalesceSize  int
+	CoalesceDelay time.Duration
+	// Clock CoalesceDelay is measured with, nil is the system clock.
+	Clock Clock
+}
+
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		ChunkSize:     4096,
+		Queue:         16,
+		Backpressure:  BackpressureBlock,
+		Latency:       LatencyLow,
+		CoalesceSize:  64 * 1024,
+		CoalesceDelay: 5 * time.Millisecond,
+	}
+}
+
+// Stream reads a pty in its own goroutine and delivers the output on a channel,
+// for event driven consumers that don't want to block on a reader.
+type Stream struct {
+	output chan []byte
+	pool   sync.Pool
+	// buffers of CoalesceSize for LatencyThroughput
+	coalescePool sync.Pool
+	opts         StreamOptions
+	err          error
+	dropped      atomic.Uint64
+
+	r        io.Reader
+	stop     chan struct{}
+	stopOnce sync.Once
+	// closed once r isn't read anymore
+	pumped chan struct{}
+}
+
+// Start reading r until it returns an error or Stop is called.
+func NewStream(r io.Reader, opts StreamOptions) *Stream {
+	defaults := DefaultStreamOptions()
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaults.ChunkSize
+	}
+	if opts.Queue < 0 {
+		opts.Queue = 0
+	}
+	if opts.CoalesceSize <= 0 {
+		opts.CoalesceSize = defaults.CoalesceSize
+	}
+
+	s := &Stream{
+		output: make(chan []byte, opts.Queue),
+		opts:   opts,
+		r:      r,
+		stop:   make(chan struct{}),
+		pumped: make(chan struct{}),
+	}
+	s.pool.New = func() any {
+		buffer := make([]byte, opts.ChunkSize)
+		return &buffer
+	}
+	if opts.Latency != LatencyThroughput {
+		go s.pump(r, s.deliver, s.output)
+		return s
+	}
+
+	s.coalescePool.New = func() any {
+		buffer := make([]byte, opts.CoalesceSize)
+		return &buffer
+	}
+	// backpressure applies to the merged chunks
+	reads := make(chan []byte, opts.Queue)
+	go s.pump(r, func(chunk []byte) {
+		select {
+		case reads <- chunk:
+		case <-s.stop:
+		}
+	}, reads)
+	go s.coalesce(reads)
+	return s
+}
+
+func (s *Stream) pump(r io.Reader, send func([]byte), done chan []byte) {
+	defer close(s.pumped)
+	defer close(done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		buffer := s.pool.Get().(*[]byte)
+		n, err := r.Read(*buffer)
+		if n > 0 {
+			send((*buffer)[:n])
+		} else {
+			s.pool.Put(buffer)
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			return
+		}
+	}
+}
+
+func (s *Stream) coalesce(reads <-chan []byte) {
+	defer close(s.output)
+	clock := clockOrSystem(s.opts.Clock)
+	var out []byte
+	var deadline <-chan time.Time
+	flush := func() {
+		s.deliver(out)
+		out = nil
+		deadline = nil
+	}
+	for {
+		select {
+		case chunk, ok := <-reads:
+			if !ok {
+				if len(out) > 0 {
+					s.deliver(out)
+				}
+				return
+			}
+			for rest := chunk; len(rest) > 0; {
+				if out == nil {
+					out = (*s.coalescePool.Get().(*[]byte))[:0]
+					deadline = clock.After(s.opts.CoalesceDelay)
+				}
+				n := copy(out[len(out):cap(out)], rest)
+				out = out[:len(out)+n]
+				rest = rest[n:]
+				if len(out) == cap(out) {
+					flush()
+				}
+			}
+			s.Release(chunk)
+		case <-deadline:
+			flush()
+		}
+	}
+}
+
+func (s *Stream) deliver(chunk []byte) {
+	if s.opts.Backpressure == BackpressureBlock {
+		select {
+		case s.output <- chunk:
+		case <-s.stop:
+		}
+		return
+	}
+	select {
+	case s.output <- chunk:
+	default:
+		s.dropped.Add(uint64(len(chunk)))
+		s.Release(chunk)
+	}
+}
+
+// Stop reading after the read in flight and return the reader, e.g. to give it back
+// with ReturnReader. Blocks until that read returned, on a quiet pty that is once
+// there is output or the pty is closed. What is read from then on and not taken
+// by the consumer right away is discarded, Output is closed once the rest of it
+// was delivered.
+func (s *Stream) Stop() io.Reader {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.pumped
+	return s.r
+}
+
+// Output of the pty, closed once reading failed, reached the end or was stopped.
+func (s *Stream) Output() <-chan []byte {
+	return s.output
+}
+
+// Error reading stopped with, nil for io.EOF and Stop.
+// Only valid after Output is closed.
+func (s *Stream) Err() error {
+	return s.err
+}
+
+// Number of bytes dropped by BackpressureDrop.
+func (s *Stream) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Hand a chunk received from Output back for reuse.
+// Optional, chunks that are not released are garbage collected.
+func (s *Stream) Release(chunk []byte) {
+	switch {
+	case cap(chunk) == s.opts.ChunkSize:
+		chunk = chunk[:cap(chunk)]
+		s.pool.Put(&chunk)
+	case s.opts.Latency == LatencyThroughput && cap(chunk) == s.opts.CoalesceSize:
+		chunk = chunk[:cap(chunk)]
+		s.coalescePool.Put(&chunk)
+	}
+}
@@ -0,0 +1,151 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// Returns chunks one read at a time, then io.EOF after closing drained.
+type chunkReader struct {
+	chunks  []string
+	drained chan struct{}
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		close(r.drained)
+		return 0, io.EOF
+	}
+	n := copy(b, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+// Never ends, every read returns x.
+type endlessReader struct{}
+
+func (endlessReader) Read(b []byte) (int, error) {
+	return copy(b, "x"), nil
+}
+
+func collect(t *testing.T, s *Stream) string {
+	t.Helper()
+	var out strings.Builder
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case chunk, ok := <-s.Output():
+			if !ok {
+				return out.String()
+			}
+			out.Write(chunk)
+			s.Release(chunk)
+		case <-timeout:
+			t.Fatal("Output not closed")
+		}
+	}
+}
+
+func TestStreamOrder(t *testing.T) {
+	in := strings.Repeat("0123456789", 1000)
+	opts := DefaultStreamOptions()
+	opts.ChunkSize = 7
+	s := NewStream(iotest.OneByteReader(strings.NewReader(in)), opts)
+	if out := collect(t, s); out != in {
+		t.Errorf("got %d bytes out of order, want %d", len(out), len(in))
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("got %v, want nil for io.EOF", err)
+	}
+}
+
+func TestStreamErr(t *testing.T) {
+	cause := errors.New("broken")
+	s := NewStream(io.MultiReader(strings.NewReader("out"), iotest.ErrReader(cause)), DefaultStreamOptions())
+	if out := collect(t, s); out != "out" {
+		t.Errorf("got %q, want out", out)
+	}
+	if err := s.Err(); !errors.Is(err, cause) {
+		t.Errorf("got %v, want %v", err, cause)
+	}
+}
+
+func TestStreamDrop(t *testing.T) {
+	r := &chunkReader{chunks: []string{"a", "bc", "def"}, drained: make(chan struct{})}
+	opts := DefaultStreamOptions()
+	opts.Queue = 1
+	opts.Backpressure = BackpressureDrop
+	s := NewStream(r, opts)
+
+	// nobody consumes until everything was read: the first chunk is queued, the rest dropped
+	<-r.drained
+	if out := collect(t, s); out != "a" {
+		t.Errorf("got %q, want a", out)
+	}
+	if dropped := s.Dropped(); dropped != 5 {
+		t.Errorf("dropped %d bytes, want 5", dropped)
+	}
+}
+
+func TestStreamRelease(t *testing.T) {
+	opts := DefaultStreamOptions()
+	opts.ChunkSize = 16
+	s := NewStream(strings.NewReader(""), opts)
+	collect(t, s)
+
+	// the pool may drop what is put into it, the race detector does on purpose
+	reused := false
+	for i := 0; i < 20 && !reused; i++ {
+		chunk := make([]byte, 3, 16)
+		s.Release(chunk)
+		buffer := s.pool.Get().(*[]byte)
+		reused = &(*buffer)[0] == &chunk[0]
+		if len(*buffer) != 16 {
+			t.Fatalf("got a buffer of %d bytes, want 16", len(*buffer))
+		}
+	}
+	if !reused {
+		t.Error("released chunk never reused")
+	}
+
+	// chunks that didn't come from the stream aren't pooled
+	s.Release(make([]byte, 3))
+	if buffer := s.pool.Get().(*[]byte); len(*buffer) != 16 {
+		t.Errorf("got a buffer of %d bytes, want 16", len(*buffer))
+	}
+}
+
+// Stop ends pumping even when a blocked consumer went away.
+func TestStreamStop(t *testing.T) {
+	for name, latency := range map[string]Latency{"low": LatencyLow, "throughput": LatencyThroughput} {
+		opts := DefaultStreamOptions()
+		opts.Queue = 0
+		opts.Latency = latency
+		var r io.Reader = endlessReader{}
+		s := NewStream(r, opts)
+
+		stopped := make(chan io.Reader)
+		go func() { stopped <- s.Stop() }()
+		select {
+		case got := <-stopped:
+			if got != r {
+				t.Errorf("%s: got reader %v, want %v", name, got, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Stop blocked", name)
+		}
+		collect(t, s)
+		if err := s.Err(); err != nil {
+			t.Errorf("%s: got %v, want nil", name, err)
+		}
+		// stopping again is fine
+		s.Stop()
+	}
+}
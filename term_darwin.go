@@ -0,0 +1,11 @@
+//go:build darwin
+// +build darwin
+
+package pty
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlReadTermios  = unix.TIOCGETA
+	ioctlWriteTermios = unix.TIOCSETA
+)
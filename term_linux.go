@@ -0,0 +1,11 @@
+//go:build linux
+// +build linux
+
+package pty
+
+import "golang.org/x/sys/unix"
+
+const (
+	ioctlReadTermios  = unix.TCGETS
+	ioctlWriteTermios = unix.TCSETS
+)
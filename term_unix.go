@@ -0,0 +1,79 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package pty
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Terminal mode to go back to with Restore.
+type TermState struct {
+	termios unix.Termios
+}
+
+// Put the terminal fd refers to into raw mode, like cfmakeraw.
+func MakeRaw(fd int) (*TermState, error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	state := &TermState{*termios}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, termios); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func Restore(fd int, state *TermState) error {
+	return unix.IoctlSetTermios(fd, ioctlWriteTermios, &state.termios)
+}
+
+// Put the terminal of the host process into raw mode so everything typed can be
+// forwarded to a pty. The returned function restores the previous mode.
+func MakeHostRaw() (func() error, error) {
+	fd := int(unix.Stdin)
+	state, err := MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return Restore(fd, state)
+	}, nil
+}
+
+func IsTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	return err == nil
+}
+
+// Size of the terminal fd refers to.
+func GetTermSize(fd int) (PtySize, error) {
+	ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return PtySize{}, err
+	}
+	return PtySize{
+		Rows:        ws.Row,
+		Cols:        ws.Col,
+		PixelWidth:  ws.Xpixel,
+		PixelHeight: ws.Ypixel,
+	}, nil
+}
+
+// Size of the terminal the host process runs in, taken from stdout or stdin.
+func GetHostSize() (PtySize, error) {
+	size, err := GetTermSize(int(unix.Stdout))
+	if err != nil {
+		return GetTermSize(int(unix.Stdin))
+	}
+	return size, nil
+}
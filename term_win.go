@@ -0,0 +1,95 @@
+//go:build windows
+// +build windows
+
+package pty
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Console mode to go back to with Restore.
+type TermState struct {
+	mode uint32
+}
+
+// Put the console fd refers to into raw mode with virtual terminal input,
+// so key presses arrive as the escape sequences a pty expects.
+func MakeRaw(fd int) (*TermState, error) {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(fd), &mode); err != nil {
+		logger.Println(err)
+		return nil, err
+	}
+
+	raw := mode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_OUTPUT)
+	raw |= windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(windows.Handle(fd), raw); err != nil {
+		logger.Println(err)
+		return nil, err
+	}
+	return &TermState{mode}, nil
+}
+
+func Restore(fd int, state *TermState) error {
+	return windows.SetConsoleMode(windows.Handle(fd), state.mode)
+}
+
+// Put the console of the host process into raw mode so everything typed can be
+// forwarded to a pty, and let it interpret the escape sequences the pty outputs.
+// The returned function restores the previous modes.
+func MakeHostRaw() (func() error, error) {
+	stdin := int(os.Stdin.Fd())
+	stdout := windows.Handle(os.Stdout.Fd())
+
+	state, err := MakeRaw(stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	var outMode uint32
+	if err := windows.GetConsoleMode(stdout, &outMode); err != nil {
+		logger.Println(err)
+		Restore(stdin, state)
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(
+		stdout,
+		outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING|windows.DISABLE_NEWLINE_AUTO_RETURN,
+	); err != nil {
+		logger.Println(err)
+		Restore(stdin, state)
+		return nil, err
+	}
+
+	return func() error {
+		if err := windows.SetConsoleMode(stdout, outMode); err != nil {
+			return err
+		}
+		return Restore(stdin, state)
+	}, nil
+}
+
+func IsTerminal(fd int) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(fd), &mode) == nil
+}
+
+// Size of the visible window of the console screen buffer fd refers to.
+// Consoles don't report pixel sizes.
+func GetTermSize(fd int) (PtySize, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return PtySize{}, err
+	}
+	return PtySize{
+		Rows: uint16(info.Window.Bottom - info.Window.Top + 1),
+		Cols: uint16(info.Window.Right - info.Window.Left + 1),
+	}, nil
+}
+
+// Size of the console the host process runs in, taken from stdout.
+func GetHostSize() (PtySize, error) {
+	return GetTermSize(int(os.Stdout.Fd()))
+}
@@ -0,0 +1,52 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writer adds conveniences for typing into a pty on top of its writer.
+type Writer struct {
+	w io.Writer
+	// Sent by WriteLine after the line. Defaults to "\r", which is what terminals send for Enter.
+	Newline string
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, Newline: "\r"}
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func (w *Writer) WriteString(s string) (int, error) {
+	return w.w.Write([]byte(s))
+}
+
+func (w *Writer) Writef(format string, args ...any) (int, error) {
+	return w.w.Write(fmt.Appendf(nil, format, args...))
+}
+
+// Write s followed by Newline in a single write.
+func (w *Writer) WriteLine(s string) (int, error) {
+	return w.w.Write([]byte(s + w.Newline))
+}
+
+// Send the control character for Ctrl and c, e.g. WriteCtrl('c') for an interrupt
+// or WriteCtrl('d') for end of input. WriteCtrl('?') sends DEL.
+func (w *Writer) WriteCtrl(c byte) error {
+	switch {
+	case c == '?':
+		c = 0x7f
+	case c >= 'a' && c <= 'z', c >= '@' && c <= '_':
+		c &= 0x1f
+	default:
+		return fmt.Errorf("no control character for %q", c)
+	}
+	_, err := w.w.Write([]byte{c})
+	return err
+}
@@ -0,0 +1,61 @@
+//go:build linux || darwin || windows
+// +build linux darwin windows
+
+package pty
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteCtrl(t *testing.T) {
+	for _, tc := range []struct {
+		c    byte
+		want string
+	}{
+		{'c', "\x03"},
+		{'C', "\x03"},
+		{'d', "\x04"},
+		{'z', "\x1a"},
+		{'@', "\x00"},
+		{'[', "\x1b"},
+		{'\\', "\x1c"},
+		{'_', "\x1f"},
+		{'?', "\x7f"},
+		{'1', ""},
+		{' ', ""},
+		{'~', ""},
+	} {
+		var out bytes.Buffer
+		err := NewWriter(&out).WriteCtrl(tc.c)
+		if tc.want == "" {
+			if err == nil || out.Len() > 0 {
+				t.Errorf("%q: got %q, %v, want an error", tc.c, out.String(), err)
+			}
+			continue
+		}
+		if err != nil || out.String() != tc.want {
+			t.Errorf("%q: got %q, %v, want %q", tc.c, out.String(), err, tc.want)
+		}
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	for _, tc := range []struct {
+		newline string
+		want    string
+	}{
+		{"", "ls\r"},
+		{"\n", "ls\n"},
+		{"\r\n", "ls\r\n"},
+	} {
+		var out bytes.Buffer
+		w := NewWriter(&out)
+		if tc.newline != "" {
+			w.Newline = tc.newline
+		}
+		if n, err := w.WriteLine("ls"); err != nil || n != len(tc.want) || out.String() != tc.want {
+			t.Errorf("%q: got %q, %d, %v, want %q", tc.newline, out.String(), n, err, tc.want)
+		}
+	}
+}